@@ -1,10 +1,12 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"os"
 	"regexp"
+	"strings"
 	"time"
 
 	"github.com/yukithm/mmbot"
@@ -38,8 +40,13 @@ func main() {
 
 	myapp.InitRobot = func(robot *mmbot.Robot) error {
 		// fmt.Printf("%#v\n", config.Example)
+		robot.Use(
+			mmbot.TimingMiddleware(robot.Logger, 3*time.Second),
+		)
 		initHandlers(robot)
 		initRoutes(robot)
+		initActions(robot)
+		initDialogs(robot)
 		initJobs(robot)
 		return nil
 	}
@@ -75,6 +82,144 @@ func initHandlers(robot *mmbot.Robot) {
 				return msg.Reply(fmt.Sprintf("@%sさん、こんにちは！", msg.UserName))
 			},
 		},
+		mmbot.CommandHandler{
+			MessageType: message.MentionMessage | message.DirectMessage | message.CommandMessage,
+			Commands: []mmbot.Command{
+				{
+					Name:        "echo",
+					Description: "Repeat the text",
+					Args: []mmbot.CommandArg{
+						{Name: "text", Variadic: true},
+					},
+					Flags: []mmbot.CommandFlag{
+						{Name: "times", Type: mmbot.IntArg, Default: "1", Usage: "number of repetition"},
+					},
+					Action: func(msg *message.InMessage) error {
+						text := strings.Repeat(msg.Args.String("text")+" ", msg.Args.Int("times"))
+						return msg.Reply(text)
+					},
+				},
+				{
+					Name:        "deploy",
+					Description: "Deploy the service after approval",
+					Args: []mmbot.CommandArg{
+						{Name: "service"},
+					},
+					Permission: mmbot.Permission{Groups: []string{"deploy"}},
+					Action: func(msg *message.InMessage) error {
+						service := msg.Args.String("service")
+						return msg.Sender.Send(&message.OutMessage{
+							ChannelID:   msg.ChannelID,
+							ChannelName: msg.ChannelName,
+							Attachments: []*message.Attachment{
+								{
+									Text: fmt.Sprintf("Approve deploy of %s?", service),
+									Actions: []*message.Action{
+										mmbot.NewButton("deploy", "Yes", map[string]interface{}{"service": service, "approved": true}),
+										mmbot.NewButton("deploy", "No", map[string]interface{}{"service": service, "approved": false}),
+									},
+								},
+							},
+							TriggeredBy: msg,
+						})
+					},
+				},
+				{
+					Name:        "report",
+					Description: "File an incident with a form (slash command only)",
+					Action: func(msg *message.InMessage) error {
+						if msg.TriggerID == "" {
+							return msg.Reply("Use the slash command to open the form.")
+						}
+						return robot.OpenDialog(msg.TriggerID, "incident", &message.Dialog{
+							Title: "Incident report",
+							Elements: []*message.DialogElement{
+								{DisplayName: "Title", Name: "title", Type: message.TextElement},
+								{DisplayName: "Severity", Name: "severity", Type: message.SelectElement, Options: []*message.DialogOption{
+									{Text: "Low", Value: "low"},
+									{Text: "High", Value: "high"},
+								}},
+								{DisplayName: "Details", Name: "details", Type: message.TextareaElement, Optional: true},
+								{DisplayName: "Customer impact", Name: "impact", Type: message.BoolElement, Optional: true},
+							},
+						})
+					},
+				},
+				{
+					Name:        "incident",
+					Description: "File an incident step by step",
+					Action: func(msg *message.InMessage) error {
+						return fileIncident(robot, msg)
+					},
+				},
+				robot.GroupCommand(),
+			},
+		},
+	}
+
+	robot.Fallback = mmbot.PatternHandler{
+		MessageType: message.MentionMessage | message.DirectMessage,
+		Pattern:     regexp.MustCompile(`.*`),
+		Action: func(msg *message.InMessage) error {
+			return msg.Reply("Sorry, I don't understand.")
+		},
+	}
+}
+
+func fileIncident(robot *mmbot.Robot, msg *message.InMessage) error {
+	conv := &mmbot.Conversation{
+		OnTimeout: func(conv *mmbot.Conversation) {
+			conv.Origin.Reply("Incident filing timed out.")
+		},
+	}
+	err := robot.StartConversation(msg, conv, func(conv *mmbot.Conversation, msg *message.InMessage) error {
+		conv.Values["title"] = msg.MentionlessText()
+		if err := conv.Next(func(conv *mmbot.Conversation, msg *message.InMessage) error {
+			return msg.Reply(fmt.Sprintf("Filed incident %q (severity: %s)", conv.Values["title"], msg.MentionlessText()))
+		}); err != nil {
+			return err
+		}
+		return msg.Reply("Severity? (low/high)")
+	})
+	if err != nil {
+		return err
+	}
+	return msg.Reply("Title of the incident? (mention me with the answer, or \"cancel\" to stop)")
+}
+
+func initActions(robot *mmbot.Robot) {
+	robot.Actions = []mmbot.ActionHandler{
+		{
+			Name:       "deploy",
+			Permission: mmbot.Permission{Groups: []string{"deploy"}},
+			Action: func(ctx context.Context, req *mmbot.ActionRequest) (*mmbot.ActionResponse, error) {
+				service := req.Value("service")
+				if req.Value("approved") != "true" {
+					return mmbot.UpdatePost(fmt.Sprintf("Deploy of %s was rejected by @%s", service, req.UserName)), nil
+				}
+				return mmbot.UpdatePost(fmt.Sprintf("Deploy of %s was approved by @%s", service, req.UserName)), nil
+			},
+		},
+	}
+}
+
+func initDialogs(robot *mmbot.Robot) {
+	robot.Dialogs = []mmbot.DialogHandler{
+		{
+			Name: "incident",
+			Action: func(ctx context.Context, sub *mmbot.DialogSubmission) (*mmbot.DialogResponse, error) {
+				if len(sub.String("title")) < 5 {
+					return mmbot.FieldError("title", "Title must be at least 5 characters"), nil
+				}
+				return nil, robot.Send(&message.OutMessage{
+					ChannelID:   sub.ChannelID,
+					ChannelName: sub.ChannelName,
+					Adapter:     sub.Adapter,
+					Text: fmt.Sprintf("Incident %q filed (severity: %s, customer impact: %t)",
+						sub.String("title"), sub.String("severity"), sub.Bool("impact")),
+				})
+			},
+		},
 	}
 }
 
@@ -82,6 +227,7 @@ func initRoutes(robot *mmbot.Robot) {
 	robot.Routes = []mmbot.Route{
 		mmbot.NewPingRoute("/ping"),
 		mmbot.NewStatsRoute("/stats"),
+		mmbot.NewRobotStatsRoute("/robot/stats"),
 		mmbot.Route{
 			Methods: []string{"GET"},
 			Pattern: "/hello",
@@ -97,9 +243,9 @@ func initJobs(robot *mmbot.Robot) {
 		mmbot.Job{
 			Schedule: "0 * * * * *",
 			Action: func(bot *mmbot.Robot) {
-				fmt.Printf("job: %s", time.Now())
+				fmt.Printf("job: %s", bot.Now())
 				bot.Send(&message.OutMessage{
-					Text: fmt.Sprintf("job: %s", time.Now()),
+					Text: fmt.Sprintf("job: %s", bot.Now()),
 				})
 			},
 		},
@@ -0,0 +1,325 @@
+package mmbot
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/yukithm/mmbot/brain"
+	"github.com/yukithm/mmbot/message"
+)
+
+// AdminGroup is the group whose members can manage groups by GroupCommand.
+const AdminGroup = "admin"
+
+// GroupsBrainKey is the Brain key that stores groups when Config.PersistGroups is true.
+const GroupsBrainKey = "mmbot:groups"
+
+// Permission declares who can use a handler.
+// A message is permitted if its sender is in Users or a member of Groups,
+// and it is posted in one of Channels. Empty lists do not restrict.
+type Permission struct {
+	Users    []string // user names
+	Groups   []string // group names (see Config.Groups)
+	Channels []string // channel names or IDs
+}
+
+// IsZero reports whether the permission permits everyone.
+func (p Permission) IsZero() bool {
+	return len(p.Users) == 0 && len(p.Groups) == 0 && len(p.Channels) == 0
+}
+
+// PermissionHandler is a handler that restricts who can use it.
+// The robot checks the permission after CanHandle returns true.
+// Denied messages are logged and answered once with Config.DenyMessage if it is set,
+// even if several handlers deny them.
+type PermissionHandler interface {
+	Handler
+	HandlerPermission(*message.InMessage) Permission
+}
+
+// Permitted reports whether the message satisfies the permission.
+func (r *Robot) Permitted(perm Permission, msg *message.InMessage) bool {
+	if len(perm.Channels) > 0 &&
+		!containsString(perm.Channels, msg.ChannelName) && !containsString(perm.Channels, msg.ChannelID) {
+		return false
+	}
+	if len(perm.Users) == 0 && len(perm.Groups) == 0 {
+		return true
+	}
+	if containsString(perm.Users, msg.UserName) {
+		return true
+	}
+	for _, group := range perm.Groups {
+		if r.InGroup(msg.UserName, group) {
+			return true
+		}
+	}
+	return false
+}
+
+// permitted reports whether the handler permits the message.
+func (r *Robot) permitted(handler Handler, msg *message.InMessage) bool {
+	h, ok := handler.(PermissionHandler)
+	if !ok {
+		return true
+	}
+	return r.Permitted(h.HandlerPermission(msg), msg)
+}
+
+// logDenied logs the message that a handler denied.
+func (r *Robot) logDenied(msg *message.InMessage) {
+	r.Logger.Printf("Access denied: %q in %q: %q", msg.UserName, msg.ChannelName, msg.Text)
+}
+
+// deny replies Config.DenyMessage to the denied message
+// if it is a mention, a direct message or a slash command.
+func (r *Robot) deny(msg *message.InMessage) {
+	if r.Config.DenyMessage == "" {
+		return
+	}
+	if msg.Type&(message.MentionMessage|message.DirectMessage|message.CommandMessage) == 0 {
+		return
+	}
+	if err := msg.Reply(r.Config.DenyMessage); err != nil {
+		r.Logger.Print(err)
+	}
+}
+
+// users remembers the names of the users who sent messages through the adapters.
+// Callbacks of actions tell the user name, but it is not verified,
+// so permissions of callbacks use the name known for the user ID.
+type users struct {
+	mu    sync.Mutex
+	names map[string]string // user ID -> user name
+}
+
+// rememberUser remembers the name of the sender of the message.
+func (r *Robot) rememberUser(msg *message.InMessage) {
+	if msg.UserID == "" || msg.UserName == "" {
+		return
+	}
+
+	r.users.mu.Lock()
+	defer r.users.mu.Unlock()
+
+	if r.users.names == nil {
+		r.users.names = make(map[string]string)
+	}
+	r.users.names[msg.UserID] = msg.UserName
+}
+
+// UserName returns the name of the user ID that the robot has seen in received messages.
+// It returns an empty string if the user has not sent any message since the robot started.
+func (r *Robot) UserName(userID string) string {
+	r.users.mu.Lock()
+	defer r.users.mu.Unlock()
+
+	return r.users.names[userID]
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+type groups struct {
+	mu      sync.Mutex
+	members map[string]map[string]bool // group name -> user names
+}
+
+// loadGroups initializes the groups from Config.Groups, or from Brain if persisted.
+// r.groups.mu must be locked by the caller.
+func (r *Robot) loadGroups() {
+	if r.groups.members != nil {
+		return
+	}
+
+	defs := r.Config.Groups
+	if r.Config.PersistGroups && r.Brain != nil {
+		buf, err := r.Brain.Get(GroupsBrainKey)
+		if err == nil {
+			var saved map[string][]string
+			if err := json.Unmarshal(buf, &saved); err != nil {
+				r.Logger.Printf("Invalid groups in brain: %v", err)
+			} else {
+				defs = saved
+			}
+		} else if err != brain.ErrNotFound {
+			r.Logger.Printf("Cannot load groups: %v", err)
+		}
+	}
+
+	r.groups.members = make(map[string]map[string]bool, len(defs))
+	for name, users := range defs {
+		members := make(map[string]bool, len(users))
+		for _, user := range users {
+			members[user] = true
+		}
+		r.groups.members[name] = members
+	}
+}
+
+// saveGroups stores the groups into Brain if Config.PersistGroups is true.
+// r.groups.mu must be locked by the caller.
+func (r *Robot) saveGroups() error {
+	if !r.Config.PersistGroups || r.Brain == nil {
+		return nil
+	}
+
+	defs := make(map[string][]string, len(r.groups.members))
+	for name := range r.groups.members {
+		defs[name] = sortedKeys(r.groups.members[name])
+	}
+	buf, err := json.Marshal(defs)
+	if err != nil {
+		return err
+	}
+	return r.Brain.Set(GroupsBrainKey, buf)
+}
+
+// InGroup reports whether the user is a member of the group.
+func (r *Robot) InGroup(user, group string) bool {
+	r.groups.mu.Lock()
+	defer r.groups.mu.Unlock()
+
+	r.loadGroups()
+	return r.groups.members[group][user]
+}
+
+// GroupNames returns the sorted names of the groups.
+func (r *Robot) GroupNames() []string {
+	r.groups.mu.Lock()
+	defer r.groups.mu.Unlock()
+
+	r.loadGroups()
+	names := make([]string, 0, len(r.groups.members))
+	for name := range r.groups.members {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GroupMembers returns the sorted members of the group.
+func (r *Robot) GroupMembers(group string) []string {
+	r.groups.mu.Lock()
+	defer r.groups.mu.Unlock()
+
+	r.loadGroups()
+	return sortedKeys(r.groups.members[group])
+}
+
+// AddGroupMembers adds the users to the group. The group is created if it does not exist.
+func (r *Robot) AddGroupMembers(group string, users ...string) error {
+	r.groups.mu.Lock()
+	defer r.groups.mu.Unlock()
+
+	r.loadGroups()
+	members := r.groups.members[group]
+	if members == nil {
+		members = make(map[string]bool)
+		r.groups.members[group] = members
+	}
+	for _, user := range users {
+		members[user] = true
+	}
+	return r.saveGroups()
+}
+
+// RemoveGroupMembers removes the users from the group.
+// The group is deleted when it has no members.
+func (r *Robot) RemoveGroupMembers(group string, users ...string) error {
+	r.groups.mu.Lock()
+	defer r.groups.mu.Unlock()
+
+	r.loadGroups()
+	members := r.groups.members[group]
+	for _, user := range users {
+		delete(members, user)
+	}
+	if len(members) == 0 {
+		delete(r.groups.members, group)
+	}
+	return r.saveGroups()
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// GroupCommand returns the command to manage groups at runtime.
+// Only the members of AdminGroup can use it.
+//
+//	group list
+//	group show <group>
+//	group add <group> <user>...
+//	group remove <group> <user>...
+func (r *Robot) GroupCommand() Command {
+	return Command{
+		Name:        "group",
+		Description: "Manage groups (list, show, add, remove)",
+		Args: []CommandArg{
+			{Name: "action"},
+			{Name: "group", Optional: true},
+			{Name: "users", Optional: true, Variadic: true},
+		},
+		Permission: Permission{Groups: []string{AdminGroup}},
+		Action:     r.groupCommand,
+	}
+}
+
+func (r *Robot) groupCommand(msg *message.InMessage) error {
+	action := msg.Args.String("action")
+	group := msg.Args.String("group")
+	users := strings.Fields(msg.Args.String("users"))
+	for i, user := range users {
+		users[i] = strings.TrimPrefix(user, "@")
+	}
+
+	switch action {
+	case "list":
+		names := r.GroupNames()
+		if len(names) == 0 {
+			return msg.Reply("No groups")
+		}
+		return msg.Reply("Groups: " + strings.Join(names, ", "))
+	case "show":
+		if group == "" {
+			return msg.Reply("Usage: group show <group>")
+		}
+	case "add", "remove":
+		if group == "" || len(users) == 0 {
+			return msg.Reply(fmt.Sprintf("Usage: group %s <group> <user>...", action))
+		}
+		var err error
+		if action == "add" {
+			err = r.AddGroupMembers(group, users...)
+		} else {
+			err = r.RemoveGroupMembers(group, users...)
+		}
+		if err != nil {
+			return err
+		}
+		r.Logger.Printf("Group %q: %s %s by %q", group, action, strings.Join(users, ", "), msg.UserName)
+	default:
+		return msg.Reply(fmt.Sprintf("Unknown action %q (list, show, add, remove)", action))
+	}
+
+	members := r.GroupMembers(group)
+	if len(members) == 0 {
+		return msg.Reply(fmt.Sprintf("Group %q has no members", group))
+	}
+	return msg.Reply(fmt.Sprintf("Members of %q: %s", group, strings.Join(members, ", ")))
+}
@@ -0,0 +1,285 @@
+package mmbot
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/yukithm/mmbot/message"
+)
+
+// Context keys of actions that the robot uses.
+const (
+	ActionNameKey   = "mmbot_action" // name of the ActionHandler
+	ActionSecretKey = "mmbot_secret" // Config.ActionSecret
+)
+
+// DefaultActionPath is the default path of the callback route of actions.
+const DefaultActionPath = "/mmbot/actions"
+
+// ActionRequest is a callback request of an interactive message action.
+// (received from Mattermost)
+type ActionRequest struct {
+	UserID      string                 `json:"user_id"`
+	UserName    string                 `json:"user_name"` // the name in the request; see Robot.UserName for permissions
+	ChannelID   string                 `json:"channel_id"`
+	ChannelName string                 `json:"channel_name"`
+	TeamID      string                 `json:"team_id"`
+	TeamDomain  string                 `json:"team_domain"`
+	PostID      string                 `json:"post_id"`
+	TriggerID   string                 `json:"trigger_id"` // for opening a dialog
+	Type        string                 `json:"type"`
+	DataSource  string                 `json:"data_source"`
+	Context     map[string]interface{} `json:"context"`
+}
+
+// Action returns the name of the ActionHandler.
+func (req *ActionRequest) Action() string {
+	return req.contextString(ActionNameKey)
+}
+
+// SelectedOption returns the selected value of the select menu.
+func (req *ActionRequest) SelectedOption() string {
+	return req.contextString("selected_option")
+}
+
+// Value returns the context value of the key as a string.
+func (req *ActionRequest) Value(key string) string {
+	return req.contextString(key)
+}
+
+// message returns the message that represents the callback for permissions and middlewares.
+// The user name is the name that the robot knows for the user ID.
+func (req *ActionRequest) message(userName string) *message.InMessage {
+	return &message.InMessage{
+		ChannelID:   req.ChannelID,
+		ChannelName: req.ChannelName,
+		UserID:      req.UserID,
+		UserName:    userName,
+		PostID:      req.PostID,
+		TriggerID:   req.TriggerID,
+		RawMessage:  req,
+	}
+}
+
+func (req *ActionRequest) contextString(key string) string {
+	switch v := req.Context[key].(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// ActionResponse is a response to an action callback.
+// (send to Mattermost)
+type ActionResponse struct {
+	Update        *ActionUpdate `json:"update,omitempty"`         // update of the original post
+	EphemeralText string        `json:"ephemeral_text,omitempty"` // message shown only to the user
+	GotoLocation  string        `json:"goto_location,omitempty"`  // URL that the client navigates to
+}
+
+// ActionUpdate is an update of the post that has the action.
+type ActionUpdate struct {
+	Message string                 `json:"message"`
+	Props   map[string]interface{} `json:"props,omitempty"`
+}
+
+// UpdatePost returns the response that replaces the text and attachments of the original post.
+// The buttons of the post are removed unless the attachments have actions.
+func UpdatePost(text string, attachments ...*message.Attachment) *ActionResponse {
+	if attachments == nil {
+		attachments = []*message.Attachment{}
+	}
+	return &ActionResponse{
+		Update: &ActionUpdate{
+			Message: text,
+			Props:   map[string]interface{}{"attachments": attachments},
+		},
+	}
+}
+
+// EphemeralResponse returns the response that shows the text only to the user.
+func EphemeralResponse(text string) *ActionResponse {
+	return &ActionResponse{EphemeralText: text}
+}
+
+// ActionFunc is a function that processes an action callback.
+// It can return nil response to leave the post as is.
+type ActionFunc func(ctx context.Context, req *ActionRequest) (*ActionResponse, error)
+
+// ActionHandler is a handler of action callbacks.
+// The users and groups of Permission are checked by the name that the robot
+// knows for the user ID (see Robot.UserName), so users whose messages the robot
+// has not received since it started are denied by them.
+type ActionHandler struct {
+	Name       string // name of the action that is referred by NewButton and NewSelect
+	Action     ActionFunc
+	Permission Permission // who can use the action (default: everyone)
+}
+
+// NewButton returns a button that calls the ActionHandler of the name.
+// The integration URL is filled in when the robot sends the message.
+func NewButton(action string, text string, context map[string]interface{}) *message.Action {
+	return &message.Action{
+		Name:        text,
+		Type:        message.ButtonAction,
+		Integration: newActionIntegration(action, context),
+	}
+}
+
+// NewSelect returns a select menu that calls the ActionHandler of the name.
+// The integration URL is filled in when the robot sends the message.
+func NewSelect(action string, text string, options []*message.ActionOption, context map[string]interface{}) *message.Action {
+	return &message.Action{
+		Name:        text,
+		Type:        message.SelectAction,
+		Options:     options,
+		Integration: newActionIntegration(action, context),
+	}
+}
+
+func newActionIntegration(action string, context map[string]interface{}) *message.ActionIntegration {
+	ctx := make(map[string]interface{}, len(context)+1)
+	for key, value := range context {
+		ctx[key] = value
+	}
+	ctx[ActionNameKey] = action
+	return &message.ActionIntegration{Context: ctx}
+}
+
+// actionURL returns the integration URL of actions.
+func (r *Robot) actionURL() string {
+	return strings.TrimRight(r.Config.PublicURL, "/") + r.Config.actionPath()
+}
+
+// prepareActions fills the integration URL and the secret of the actions of the message.
+func (r *Robot) prepareActions(msg *message.OutMessage) {
+	for _, a := range msg.Attachments {
+		for _, action := range a.Actions {
+			in := action.Integration
+			if in == nil || in.Context[ActionNameKey] == nil {
+				continue
+			}
+			if in.URL == "" {
+				in.URL = r.actionURL()
+			}
+			if r.Config.ActionSecret != "" {
+				in.Context[ActionSecretKey] = r.Config.ActionSecret
+			}
+		}
+	}
+}
+
+func (r *Robot) mountActions(mux *mux.Router) {
+	if len(r.Actions) == 0 {
+		return
+	}
+	if r.Config.ActionSecret == "" {
+		r.Logger.Println("WARNING: Action callbacks are disabled because ActionSecret is not configured")
+		return
+	}
+	mux.HandleFunc(r.Config.actionPath(), r.serveAction).Methods("POST")
+}
+
+// serveAction receives an action callback and calls the ActionHandler.
+func (r *Robot) serveAction(w http.ResponseWriter, req *http.Request) {
+	var ar ActionRequest
+	if err := json.NewDecoder(req.Body).Decode(&ar); err != nil {
+		r.Logger.Printf("Invalid action request: %v", err)
+		http.Error(w, "400 Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	given := ar.contextString(ActionSecretKey)
+	if secret := r.Config.ActionSecret; secret == "" || subtle.ConstantTimeCompare([]byte(given), []byte(secret)) != 1 {
+		r.Logger.Printf("Invalid action secret from %q", req.RemoteAddr)
+		http.Error(w, "403 Forbidden", http.StatusForbidden)
+		return
+	}
+
+	handler := r.findAction(ar.Action())
+	if handler == nil {
+		r.Logger.Printf("Unknown action %q", ar.Action())
+		http.Error(w, "404 Not Found", http.StatusNotFound)
+		return
+	}
+
+	msg := ar.message(r.UserName(ar.UserID))
+	r.rememberTrigger(msg)
+
+	var res *ActionResponse
+	err := r.callCallback(handler.Permission, msg, func(ctx context.Context, msg *message.InMessage) error {
+		var err error
+		res, err = handler.Action(ctx, &ar)
+		return err
+	})
+	switch err {
+	case nil:
+	case ErrAccessDenied:
+		res = EphemeralResponse(r.Config.DenyMessage)
+	case ErrRateLimited:
+		if r.Config.LimitPolicy == LimitNotify {
+			res = EphemeralResponse(r.Config.cooldownMessage())
+		}
+	default:
+		http.Error(w, "500 Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if res == nil {
+		res = &ActionResponse{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		r.Logger.Printf("Failed to write action response: %v", err)
+	}
+}
+
+func (r *Robot) findAction(name string) *ActionHandler {
+	for i := range r.Actions {
+		if r.Actions[i].Name == name {
+			return &r.Actions[i]
+		}
+	}
+	return nil
+}
+
+// callCallback calls the callback of an interactive message or dialog like a handler:
+// the permission, the user and channel limits and the middlewares apply to it.
+// It returns ErrAccessDenied or ErrRateLimited if the callback is not allowed,
+// and errors of the callback are logged by the default middlewares.
+func (r *Robot) callCallback(perm Permission, msg *message.InMessage, f HandlerFunc) error {
+	msg.Sender = r
+	if !r.Permitted(perm, msg) {
+		r.logDenied(msg)
+		return ErrAccessDenied
+	}
+	if allowed, _ := r.allowSender(msg); !allowed {
+		return ErrRateLimited
+	}
+
+	ctx, cancel := r.callbackContext()
+	defer cancel()
+
+	return r.applyMiddlewares(f)(ctx, msg)
+}
+
+// callbackContext returns a context for callbacks that is canceled on
+// Config.HandlerTimeout or shutdown.
+func (r *Robot) callbackContext() (context.Context, context.CancelFunc) {
+	parent := r.ctx
+	if parent == nil {
+		parent = context.Background()
+	}
+	if r.Config.HandlerTimeout > 0 {
+		return context.WithTimeout(parent, r.Config.HandlerTimeout)
+	}
+	return context.WithCancel(parent)
+}
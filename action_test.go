@@ -0,0 +1,141 @@
+package mmbot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/yukithm/mmbot/adapter"
+	"github.com/yukithm/mmbot/message"
+)
+
+const testSecret = "secret"
+
+// testAdapter records sent messages and opened dialogs.
+type testAdapter struct {
+	mu      sync.Mutex
+	sent    []*message.OutMessage
+	dialogs []*message.Dialog
+}
+
+func (a *testAdapter) Start() (chan message.InMessage, chan error) {
+	return make(chan message.InMessage), make(chan error)
+}
+
+func (a *testAdapter) Stop() {}
+
+func (a *testAdapter) Send(msg *message.OutMessage) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.sent = append(a.sent, msg)
+	return nil
+}
+
+func (a *testAdapter) IncomingWebHook() *adapter.IncomingWebHook {
+	return nil
+}
+
+func (a *testAdapter) OpenDialog(triggerID string, url string, dialog *message.Dialog) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.dialogs = append(a.dialogs, dialog)
+	return nil
+}
+
+func newTestRobot(secret string) (*Robot, *testAdapter) {
+	a := &testAdapter{}
+	r := NewRobot(&Config{
+		UserName:     "mmbot",
+		ActionSecret: secret,
+		DenyMessage:  "denied",
+	}, a, nil)
+	return r, a
+}
+
+// post sends the JSON request to the bot HTTP server.
+func post(r *Robot, path string, body interface{}) *httptest.ResponseRecorder {
+	buf, _ := json.Marshal(body)
+	req := httptest.NewRequest("POST", path, bytes.NewReader(buf))
+	rec := httptest.NewRecorder()
+	r.newServer().Handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func actionRequest(userID, userName, secret string) *ActionRequest {
+	return &ActionRequest{
+		UserID:   userID,
+		UserName: userName,
+		Context: map[string]interface{}{
+			ActionNameKey:   "deploy",
+			ActionSecretKey: secret,
+		},
+	}
+}
+
+func TestServeAction(t *testing.T) {
+	r, _ := newTestRobot(testSecret)
+	var called []string
+	r.Actions = []ActionHandler{
+		{
+			Name:       "deploy",
+			Permission: Permission{Users: []string{"admin"}},
+			Action: func(ctx context.Context, req *ActionRequest) (*ActionResponse, error) {
+				called = append(called, req.UserID)
+				return UpdatePost("deployed"), nil
+			},
+		},
+	}
+	// the robot knows the name of u1 from the message
+	r.Dispatch(&message.InMessage{Type: message.PublicMessage, UserID: "u1", UserName: "admin", Text: "hi"})
+
+	tests := []struct {
+		name   string
+		req    *ActionRequest
+		status int
+		text   string
+	}{
+		{"known user", actionRequest("u1", "admin", testSecret), http.StatusOK, "deployed"},
+		{"wrong secret", actionRequest("u1", "admin", "wrong"), http.StatusForbidden, ""},
+		{"no secret", actionRequest("u1", "admin", ""), http.StatusForbidden, ""},
+		{"unknown user claims the name", actionRequest("u2", "admin", testSecret), http.StatusOK, "denied"},
+	}
+	for _, tt := range tests {
+		rec := post(r, DefaultActionPath, tt.req)
+		if rec.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.name, rec.Code, tt.status)
+			continue
+		}
+		if tt.text != "" && !strings.Contains(rec.Body.String(), tt.text) {
+			t.Errorf("%s: response = %s, want %q", tt.name, rec.Body.String(), tt.text)
+		}
+	}
+	if len(called) != 1 || called[0] != "u1" {
+		t.Errorf("action called by %q, want %q", called, []string{"u1"})
+	}
+}
+
+func TestServeActionWithoutSecret(t *testing.T) {
+	r, _ := newTestRobot("")
+	called := false
+	r.Actions = []ActionHandler{
+		{
+			Name: "deploy",
+			Action: func(ctx context.Context, req *ActionRequest) (*ActionResponse, error) {
+				called = true
+				return nil, nil
+			},
+		},
+	}
+
+	rec := post(r, DefaultActionPath, actionRequest("u1", "admin", ""))
+	if rec.Code == http.StatusOK || called {
+		t.Errorf("status = %d, called = %t, want the route not served", rec.Code, called)
+	}
+}
@@ -16,6 +16,23 @@ type IncomingWebHook struct {
 	Handler http.HandlerFunc
 }
 
+// SlashCommandAdapter is an adapter that receives Mattermost slash commands.
+type SlashCommandAdapter interface {
+	Adapter
+
+	// SlashCommandHook returns webhook for slash commands. It will be disabled if nil.
+	SlashCommandHook() *IncomingWebHook
+}
+
+// DialogAdapter is an adapter that can open interactive dialogs.
+type DialogAdapter interface {
+	Adapter
+
+	// OpenDialog opens the dialog for the trigger ID.
+	// The dialog is submitted to the URL.
+	OpenDialog(triggerID string, url string, dialog *message.Dialog) error
+}
+
 // Adapter is a client to a particular chat service.
 type Adapter interface {
 	// Start starts the communication with the chat service.
@@ -1,11 +1,23 @@
 package adapter
 
+import "time"
+
 // Config for an adapter.
 type Config struct {
-	OutgoingURL        string   // URL for incoming webhook on Mattermost
-	IncomingPath       string   // Path for outgoing webhook from Mattermost
-	Tokens             []string // Tokens from Mattermost
-	OverrideUserName   string   // Overriding of username
-	IconURL            string   // Overriding of icon URL
-	InsecureSkipVerify bool     // Disable certificate checking
+	OutgoingURL        string            // URL for incoming webhook on Mattermost (default for channels not in OutgoingURLs)
+	OutgoingURLs       map[string]string // URLs for incoming webhooks on Mattermost by channel name
+	IncomingPath       string            // Path for outgoing webhook from Mattermost
+	Tokens             []string          // Tokens from Mattermost
+	CommandPath        string            // Path for slash commands from Mattermost
+	CommandTokens      []string          // Tokens of slash commands from Mattermost
+	SyncResponse       bool              // Reply through outgoing webhook responses
+	ResponseTimeout    time.Duration     // Time to wait for synchronous responses
+	SendQueueSize      int               // Size of the queue of outgoing messages
+	SendRetries        int               // Max retries of sending a message (negative: no retries)
+	ServerURL          string            // Mattermost server URL for REST API
+	AccessToken        string            // Access token of the bot account for REST API
+	TeamName           string            // Team name for resolving channel names
+	OverrideUserName   string            // Overriding of username
+	IconURL            string            // Overriding of icon URL
+	InsecureSkipVerify bool              // Disable certificate checking
 }
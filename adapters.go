@@ -0,0 +1,165 @@
+package mmbot
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/yukithm/mmbot/adapter"
+	"github.com/yukithm/mmbot/message"
+)
+
+// DefaultAdapterName is the name of Robot.Client.
+const DefaultAdapterName = "default"
+
+// adapterEvent tells that an adapter has failed.
+// err is nil if the receiver of the adapter has been closed.
+type adapterEvent struct {
+	name string
+	err  error
+}
+
+// allAdapters returns Robot.Client and Robot.Adapters by name.
+func (r *Robot) allAdapters() map[string]adapter.Adapter {
+	adapters := make(map[string]adapter.Adapter, len(r.Adapters)+1)
+	for name, a := range r.Adapters {
+		adapters[name] = a
+	}
+	if r.Client != nil {
+		adapters[DefaultAdapterName] = r.Client
+	}
+	return adapters
+}
+
+// adapterNames returns the names of all adapters in order.
+func (r *Robot) adapterNames() []string {
+	var names []string
+	for name := range r.allAdapters() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Adapter returns the adapter of the name.
+// The empty name and DefaultAdapterName mean Robot.Client.
+func (r *Robot) Adapter(name string) (adapter.Adapter, error) {
+	if name == "" || name == DefaultAdapterName {
+		if r.Client == nil {
+			return nil, fmt.Errorf("mmbot: no default adapter")
+		}
+		return r.Client, nil
+	}
+	if a, ok := r.Adapters[name]; ok {
+		return a, nil
+	}
+	return nil, fmt.Errorf("mmbot: unknown adapter %q", name)
+}
+
+// outAdapterName returns the name of the adapter that sends the message.
+// Replies go back through the adapter that the message came from.
+func outAdapterName(msg *message.OutMessage) string {
+	if msg.Adapter != "" {
+		return msg.Adapter
+	}
+	if msg.InReplyTo != nil {
+		return msg.InReplyTo.Adapter
+	}
+	if msg.TriggeredBy != nil {
+		return msg.TriggeredBy.Adapter
+	}
+	return ""
+}
+
+// startAdapters starts all adapters and merges the received messages into one channel.
+// Each message is tagged with the name of the adapter.
+// The forwarders run until stopAdapters closes r.adaptersQuit.
+func (r *Robot) startAdapters() (chan message.InMessage, chan adapterEvent) {
+	quit := make(chan struct{})
+	r.adaptersQuit = quit
+	r.failedAdapters = make(map[string]bool)
+
+	receiver := make(chan message.InMessage)
+	events := make(chan adapterEvent)
+	for name, a := range r.allAdapters() {
+		in, errCh := a.Start()
+		r.forwarders.Add(2)
+		go r.forwardMessages(name, in, receiver, events, quit)
+		go r.forwardErrors(name, errCh, events, quit)
+	}
+
+	return receiver, events
+}
+
+func (r *Robot) forwardMessages(name string, in chan message.InMessage, receiver chan message.InMessage, events chan adapterEvent, quit chan struct{}) {
+	defer r.forwarders.Done()
+	for {
+		select {
+		case msg, ok := <-in:
+			if !ok {
+				select {
+				case events <- adapterEvent{name: name}:
+				case <-quit:
+				}
+				return
+			}
+			msg.Adapter = name
+			select {
+			case receiver <- msg:
+			case <-quit:
+				return
+			}
+		case <-quit:
+			return
+		}
+	}
+}
+
+func (r *Robot) forwardErrors(name string, errCh chan error, events chan adapterEvent, quit chan struct{}) {
+	defer r.forwarders.Done()
+	for {
+		select {
+		case err, ok := <-errCh:
+			if !ok {
+				return
+			}
+			select {
+			case events <- adapterEvent{name: name, err: err}:
+			case <-quit:
+				return
+			}
+		case <-quit:
+			return
+		}
+	}
+}
+
+// stopAdapters stops the adapters except the failed ones up to the timeout.
+func (r *Robot) stopAdapters(timeout time.Duration) {
+	var wg sync.WaitGroup
+	for name, a := range r.allAdapters() {
+		if r.failedAdapters[name] {
+			continue
+		}
+		wg.Add(1)
+		go func(name string, a adapter.Adapter) {
+			defer wg.Done()
+			stopped := make(chan struct{})
+			go func() {
+				a.Stop()
+				close(stopped)
+			}()
+			select {
+			case <-stopped:
+				r.Logger.Printf("Stop adapter %q", name)
+			case <-time.After(timeout):
+				r.Logger.Printf("Adapter %q did not stop within %s", name, timeout)
+			}
+		}(name, a)
+	}
+	wg.Wait()
+
+	close(r.adaptersQuit)
+	r.forwarders.Wait()
+}
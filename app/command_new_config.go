@@ -63,8 +63,29 @@ var NewConfigTemplate = `# {{.Name}} configuration file
 # PID file path (empty: not create)
 # pidfile = "/var/run/{{.Name}}.pid"
 
+# To run the bot for several Mattermost servers or teams, write "[[mattermost]]"
+# blocks instead of "[mattermost]". The first block is the default adapter,
+# and each other block needs a unique name. Replies are sent through the adapter
+# which received the message. The bot account must have the same username on all
+# servers; "username" of the other blocks can be omitted. For example:
+#
+#   [[mattermost]]
+#   adapter = "api"
+#   server_url = "http://localhost:8065"
+#   ...
+#
+#   [[mattermost]]
+#   name = "other"
+#   adapter = "api"
+#   server_url = "http://other.example.com"
+#   ...
 [mattermost]
-# Webhook URL for posting messages (REQUIRED)
+# Adapter type (default: "webhook")
+#   "webhook": use Incoming/Outgoing Webhooks
+#   "api":     use REST API and WebSocket API (no HTTP server is needed)
+# adapter = "webhook"
+
+# Webhook URL for posting messages (REQUIRED for "webhook" adapter unless sync_response or outgoing_urls is given)
 # (send to Mattermost; Incoming Webhooks on Mattermost side)
 outgoing_url = "http://localhost/incoming_webhook_url"
 
@@ -79,6 +100,43 @@ tokens = [
     "incomign_webhook_token"
 ]
 
+# Reply through the responses of outgoing webhooks (default: false)
+# The first reply within response_timeout is returned as the webhook response,
+# and the others are posted to outgoing_url.
+# sync_response = true
+
+# Time to wait for the synchronous response (default: "2.5s")
+# Also used for the responses of slash commands.
+# response_timeout = "2.5s"
+
+# Size of the queue of messages posted to outgoing_url (default: 100)
+# Sending returns once a message is queued, and blocks while the queue is full.
+# send_queue_size = 100
+
+# Max retries of posting a message on network errors and 5xx responses (default: 3)
+# Set a negative value to disable retries.
+# send_retries = 3
+
+# Path on the bot for receiving slash commands (default: ""; disabled)
+# (Slash Commands on Mattermost side; "webhook" adapter only)
+# NOTE: You need to enable HTTP server (server.enable = true)
+# command_path = "/{{.Name}}_command"
+
+# Tokens from Mattermost slash commands (default: [])
+# If omitted, all requests are accepted
+# command_tokens = [
+#     "slash_command_token"
+# ]
+
+# Mattermost server URL (REQUIRED for "api" adapter)
+# server_url = "http://localhost:8065"
+
+# Access token of the bot account (REQUIRED for "api" adapter)
+# access_token = "bot_access_token"
+
+# Team name for resolving channel names on "api" adapter (default: "")
+# team = "myteam"
+
 # Username of the bot account (preceded by '@') (REQUIRED)
 username = "{{.Name}}"
 
@@ -91,6 +149,14 @@ username = "{{.Name}}"
 # Disable certificate checking (default: false)
 # insecure_skip_verify = true
 
+# Webhook URLs for posting messages by channel name (default: {})
+# Messages to channels not listed here are posted to outgoing_url.
+# (Incoming Webhooks locked to a channel on Mattermost side)
+# NOTE: This table must be placed after all other "mattermost" keys.
+# [mattermost.outgoing_urls]
+# town-square = "http://localhost/incoming_webhook_url_for_town_square"
+# dev = "http://localhost/incoming_webhook_url_for_dev"
+
 [server]
 # Enable HTTP server for webhook and handlers (default: false)
 enable = true
@@ -100,4 +166,87 @@ bind_address = ""
 
 # Bind port for the bot HTTP server (default: 8080)
 port = 8080
+
+# URL of the bot HTTP server seen from Mattermost (default: "")
+# Used for the callback URLs of interactive buttons, menus and dialogs.
+# public_url = "http://localhost:8080"
+
+# Path of the callback route of interactive buttons and menus (default: "/mmbot/actions")
+# action_path = "/mmbot/actions"
+
+# Path of the submission route of interactive dialogs (default: "/mmbot/dialogs")
+# dialog_path = "/mmbot/dialogs"
+
+# Secret to verify callbacks of interactive buttons and menus
+# (required for them; the callback route is not served without it)
+# action_secret = "random_secret"
+
+[robot]
+# Number of workers that run handlers (default: 4)
+# workers = 4
+
+# Size of the queue of received messages (default: 20)
+# queue_size = 20
+
+# What to do when the queue is full (default: "block")
+#   "block":       wait for the queue (receiving messages stops meanwhile)
+#   "drop_oldest": drop the oldest queued message
+#   "drop_newest": drop the received message
+#   "reject":      drop the received message and reply reject_message
+# overflow_policy = "block"
+
+# Reply for "reject" overflow policy
+# reject_message = "Sorry, I'm too busy now. Please try again later."
+
+# Timeout of each handler call (default: ""; no timeout)
+# The context passed to handlers is canceled on timeout.
+# handler_timeout = "30s"
+
+# Timeout to process queued messages on shutdown (default: same as shutdown_timeout)
+# Running handlers are canceled after this timeout.
+# drain_timeout = "30s"
+
+# Timeout of each other shutdown phase (default: "10s")
+# (stopping HTTP server, waiting for canceled handlers and jobs, stopping adapter)
+# shutdown_timeout = "10s"
+
+# Time a conversation waits for the next message (default: "5m")
+# conversation_timeout = "5m"
+
+# Reply to messages denied by handler permissions (default: no reply)
+# deny_message = "Sorry, you are not allowed to do that."
+
+# Store groups changed by the "group" command in the brain (default: false)
+# Groups in the brain override [groups] below.
+# persist_groups = true
+
+# Limits of triggers by token buckets: burst triggers at once, then one every interval.
+# user_limit and channel_limit count mentions, direct messages and slash commands.
+# handler_limit applies to each handler (handlers can have their own limits).
+# user_limit = { burst = 5, interval = "10s" }
+# channel_limit = { burst = 20, interval = "5s" }
+# handler_limit = { burst = 10, interval = "1s" }
+
+# What to do when a limit is exceeded (default: "ignore")
+#   "ignore": ignore the message quietly
+#   "notify": reply cooldown_message once, then ignore until the interval passes
+# limit_policy = "notify"
+
+# Reply for "notify" limit policy
+# cooldown_message = "You're sending too fast. Please wait a moment."
+
+[brain]
+# Storage backend for the bot (default: "memory")
+#   "memory": in-memory (lost on exit)
+#   "file":   JSON snapshot file
+# backend = "file"
+
+# Snapshot file path for "file" backend
+# path = "./{{.Name}}-brain.json"
+
+# Members of groups for handler permissions.
+# Members of "admin" can change groups at runtime by the "group" command.
+# [groups]
+# admin = ["alice"]
+# deploy = ["alice", "bob"]
 `
@@ -8,7 +8,6 @@ import (
 	"github.com/VividCortex/godaemon"
 	"github.com/codegangsta/cli"
 	"github.com/yukithm/mmbot"
-	"github.com/yukithm/mmbot/mmhook"
 )
 
 func (app *App) newRunCommand() cli.Command {
@@ -17,6 +16,10 @@ func (app *App) newRunCommand() cli.Command {
 		Usage:       "start bot",
 		Description: "start bot",
 		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "adapter",
+				Usage: `adapter type ("webhook" or "api")`,
+			},
 			cli.StringFlag{
 				Name:  "outgoing-url",
 				Usage: "webhook URL for Mattermost (Incoming Webhooks on Mattermost side)",
@@ -30,6 +33,18 @@ func (app *App) newRunCommand() cli.Command {
 				Name:  "tokens",
 				Usage: "tokens from Mattermost outgoing webhooks",
 			},
+			cli.StringFlag{
+				Name:  "server-url",
+				Usage: "Mattermost server URL for REST API",
+			},
+			cli.StringFlag{
+				Name:  "access-token",
+				Usage: "access token of the bot account for REST API",
+			},
+			cli.StringFlag{
+				Name:  "team",
+				Usage: "team name for resolving channel names",
+			},
 			cli.StringFlag{
 				Name:  "username",
 				Usage: "username of the bot account",
@@ -120,8 +135,16 @@ func (app *App) runCommand(c *cli.Context) error {
 	}
 	defer logger.Close()
 
-	client := mmhook.NewClient(app.Config.AdapterConfig(), logger.Logger)
+	client := app.newAdapter(logger.Logger)
 	robot := mmbot.NewRobot(app.Config.RobotConfig(), client, logger.Logger)
+	robot.Adapters = app.newAdditionalAdapters(logger.Logger)
+
+	store, err := app.newBrain()
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	defer store.Close()
+	robot.Brain = store
 
 	if app.InitRobot != nil {
 		if err := app.InitRobot(robot); err != nil {
@@ -129,7 +152,7 @@ func (app *App) runCommand(c *cli.Context) error {
 		}
 	}
 
-	sigCh := make(chan os.Signal)
+	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh,
 		syscall.SIGHUP,
 		syscall.SIGINT,
@@ -1,6 +1,10 @@
 package app
 
 import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"os/signal"
 	"syscall"
@@ -10,11 +14,17 @@ import (
 	"github.com/yukithm/mmbot/shell"
 )
 
+const shellDescription = `run interactive shell, or replay a script of messages with --script.
+
+   Replies of the handlers are written in order of their priority and Robot.Handlers,
+   but messages sent from goroutines of the handlers may be written in any order.
+   See shell/testdata/batch.script for an example of the script.`
+
 func (app *App) newShellCommand() cli.Command {
 	return cli.Command{
 		Name:        "shell",
 		Usage:       "run interactive shell",
-		Description: "run interactive shell",
+		Description: shellDescription,
 		Flags: []cli.Flag{
 			cli.StringFlag{
 				Name:  "username",
@@ -45,6 +55,32 @@ func (app *App) newShellCommand() cli.Command {
 				Name:  "log",
 				Usage: "log file",
 			},
+			cli.StringFlag{
+				Name:  "format",
+				Value: shell.FormatHuman.String(),
+				Usage: "output format (human, jsonl or markdown)",
+			},
+			cli.BoolFlag{
+				Name:  "verbose",
+				Usage: "dump raw received and sent messages",
+			},
+			cli.StringFlag{
+				Name:  "script",
+				Usage: "replay messages in the script file (\"-\" for stdin) and print the transcript",
+			},
+			cli.StringFlag{
+				Name:  "golden",
+				Usage: "compare the transcript of --script with the golden file",
+			},
+			cli.BoolFlag{
+				Name:  "update-golden",
+				Usage: "write the transcript of --script to the golden file",
+			},
+			cli.DurationFlag{
+				Name:  "settle",
+				Value: shell.DefaultSettleTime,
+				Usage: "time to wait for the bot to stop sending messages after each line of --script",
+			},
 		},
 		Action: app.shellCommand,
 		Before: func(c *cli.Context) error {
@@ -67,15 +103,30 @@ func (app *App) shellCommand(c *cli.Context) error {
 	defer logger.Close()
 
 	client := shell.NewClient(app.Config.AdapterConfig(), logger.Logger)
+	if err := client.Format.UnmarshalText([]byte(c.String("format"))); err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	client.Verbose = c.Bool("verbose")
 	robot := mmbot.NewRobot(app.Config.RobotConfig(), client, logger.Logger)
 
+	store, err := app.newBrain()
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	defer store.Close()
+	robot.Brain = store
+
 	if app.InitRobot != nil {
 		if err := app.InitRobot(robot); err != nil {
 			return cli.NewExitError(err.Error(), 1)
 		}
 	}
 
-	sigCh := make(chan os.Signal)
+	if c.IsSet("script") {
+		return app.replayScript(c, client, robot)
+	}
+
+	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh,
 		syscall.SIGHUP,
 		syscall.SIGINT,
@@ -107,3 +158,46 @@ func (app *App) shellCommand(c *cli.Context) error {
 
 	return nil
 }
+
+// replayScript runs the script in batch mode.
+// The transcript is printed, or compared with the golden file.
+func (app *App) replayScript(c *cli.Context, client *shell.Client, robot *mmbot.Robot) error {
+	var script io.Reader = os.Stdin
+	if file := c.String("script"); file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		defer f.Close()
+		script = f
+	}
+
+	golden := c.String("golden")
+	if golden == "" {
+		if err := client.RunBatch(script, robot, os.Stdout, c.Duration("settle")); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		return nil
+	}
+
+	var buf bytes.Buffer
+	if err := client.RunBatch(script, robot, &buf, c.Duration("settle")); err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	if c.Bool("update-golden") {
+		if err := ioutil.WriteFile(golden, buf.Bytes(), 0644); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		return nil
+	}
+
+	want, err := ioutil.ReadFile(golden)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	if diff := shell.Diff(string(want), buf.String()); diff != "" {
+		return cli.NewExitError(fmt.Sprintf("Transcript differs from %s:\n%s", golden, diff), 1)
+	}
+	return nil
+}
@@ -2,24 +2,109 @@ package app
 
 import (
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
+	"time"
 
 	"github.com/naoina/toml"
 	"github.com/yukithm/mmbot"
 	"github.com/yukithm/mmbot/adapter"
 )
 
+// Adapter names for "mattermost.adapter".
+const (
+	AdapterWebhook = "webhook" // Incoming/Outgoing webhooks (default)
+	AdapterAPI     = "api"     // REST API and WebSocket API
+)
+
 // MattermostConfig is the configuration for mattermost.
+// The config can have several "[[mattermost]]" blocks instead of "[mattermost]".
+// The first block is the default adapter, and the others are stored in Additional.
 type MattermostConfig struct {
-	OutgoingURL        string   `toml:"outgoing_url"`
-	IncomingPath       string   `toml:"incoming_path"`
-	Tokens             []string `toml:"tokens"`
-	UserName           string   `toml:"username"`
-	OverrideUserName   string   `toml:"override_username"`
-	IconURL            string   `toml:"icon_url"`
-	InsecureSkipVerify bool     `toml:"insecure_skip_verify"`
+	Name               string            `toml:"name"` // adapter name (required for additional adapters)
+	Adapter            string            `toml:"adapter"`
+	OutgoingURL        string            `toml:"outgoing_url"`
+	OutgoingURLs       map[string]string `toml:"outgoing_urls"`
+	IncomingPath       string            `toml:"incoming_path"`
+	Tokens             []string          `toml:"tokens"`
+	CommandPath        string            `toml:"command_path"`
+	CommandTokens      []string          `toml:"command_tokens"`
+	SyncResponse       bool              `toml:"sync_response"`
+	ResponseTimeout    Duration          `toml:"response_timeout"`
+	SendQueueSize      int               `toml:"send_queue_size"`
+	SendRetries        int               `toml:"send_retries"`
+	ServerURL          string            `toml:"server_url"`
+	AccessToken        string            `toml:"access_token"`
+	TeamName           string            `toml:"team"`
+	UserName           string            `toml:"username"`
+	OverrideUserName   string            `toml:"override_username"`
+	IconURL            string            `toml:"icon_url"`
+	InsecureSkipVerify bool              `toml:"insecure_skip_verify"`
+
+	// Additional adapters given by the second and later "[[mattermost]]" blocks.
+	Additional []MattermostConfig `toml:"-"`
+}
+
+// UnmarshalTOML implements toml.UnmarshalerRec interface.
+// It accepts both a table and an array of tables.
+func (c *MattermostConfig) UnmarshalTOML(decode func(interface{}) error) error {
+	type plain MattermostConfig
+	var blocks []plain
+	if err := decode(&blocks); err != nil {
+		return decode((*plain)(c))
+	}
+
+	if len(blocks) > 0 {
+		*c = MattermostConfig(blocks[0])
+		for _, block := range blocks[1:] {
+			c.Additional = append(c.Additional, MattermostConfig(block))
+		}
+	}
+	return nil
+}
+
+// AdapterConfig returns adapter.Config.
+func (c *MattermostConfig) AdapterConfig() *adapter.Config {
+	return &adapter.Config{
+		OutgoingURL:        c.OutgoingURL,
+		OutgoingURLs:       c.OutgoingURLs,
+		IncomingPath:       c.IncomingPath,
+		Tokens:             c.Tokens,
+		CommandPath:        c.CommandPath,
+		CommandTokens:      c.CommandTokens,
+		SyncResponse:       c.SyncResponse,
+		ResponseTimeout:    c.ResponseTimeout.Duration,
+		SendQueueSize:      c.SendQueueSize,
+		SendRetries:        c.SendRetries,
+		ServerURL:          c.ServerURL,
+		AccessToken:        c.AccessToken,
+		TeamName:           c.TeamName,
+		OverrideUserName:   c.OverrideUserName,
+		IconURL:            c.IconURL,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+}
+
+func (c *MattermostConfig) validate(prefix string) []error {
+	var errs []error
+	switch c.Adapter {
+	case "", AdapterWebhook:
+		if c.OutgoingURL == "" && len(c.OutgoingURLs) == 0 && !c.SyncResponse {
+			errs = append(errs, fmt.Errorf(`"%s.outgoing_url" is required`, prefix))
+		}
+	case AdapterAPI:
+		if c.ServerURL == "" {
+			errs = append(errs, fmt.Errorf(`"%s.server_url" is required`, prefix))
+		}
+		if c.AccessToken == "" {
+			errs = append(errs, fmt.Errorf(`"%s.access_token" is required`, prefix))
+		}
+	default:
+		errs = append(errs, fmt.Errorf(`Unknown "%s.adapter": %q`, prefix, c.Adapter))
+	}
+	return errs
 }
 
 // ServerConfig is the configration for the bot HTTP server.
@@ -27,6 +112,74 @@ type ServerConfig struct {
 	Enable      bool   `toml:"enable"`
 	BindAddress string `toml:"bind_address"`
 	Port        int    `toml:"port"`
+
+	PublicURL    string `toml:"public_url"`
+	ActionPath   string `toml:"action_path"`
+	DialogPath   string `toml:"dialog_path"`
+	ActionSecret string `toml:"action_secret"`
+}
+
+// Brain backend names for "brain.backend".
+const (
+	BrainMemory = "memory" // in-memory (default)
+	BrainFile   = "file"   // JSON snapshot file
+)
+
+// BrainConfig is the configuration for the storage of the bot.
+type BrainConfig struct {
+	Backend string `toml:"backend"`
+	Path    string `toml:"path"`
+}
+
+// RobotConfig is the configuration for running handlers.
+type RobotConfig struct {
+	Workers         int                  `toml:"workers"`
+	QueueSize       int                  `toml:"queue_size"`
+	OverflowPolicy  mmbot.OverflowPolicy `toml:"overflow_policy"`
+	RejectMessage   string               `toml:"reject_message"`
+	HandlerTimeout  Duration             `toml:"handler_timeout"`
+	DrainTimeout    Duration             `toml:"drain_timeout"`
+	ShutdownTimeout Duration             `toml:"shutdown_timeout"`
+
+	ConversationTimeout Duration `toml:"conversation_timeout"`
+
+	DenyMessage   string `toml:"deny_message"`
+	PersistGroups bool   `toml:"persist_groups"`
+
+	UserLimit       LimitConfig       `toml:"user_limit"`
+	ChannelLimit    LimitConfig       `toml:"channel_limit"`
+	HandlerLimit    LimitConfig       `toml:"handler_limit"`
+	LimitPolicy     mmbot.LimitPolicy `toml:"limit_policy"`
+	CooldownMessage string            `toml:"cooldown_message"`
+}
+
+// LimitConfig is a token bucket limit such as { burst = 5, interval = "10s" }.
+type LimitConfig struct {
+	Burst    int      `toml:"burst"`
+	Interval Duration `toml:"interval"`
+}
+
+// TriggerLimit returns mmbot.TriggerLimit.
+func (c LimitConfig) TriggerLimit() mmbot.TriggerLimit {
+	return mmbot.TriggerLimit{
+		Burst:    c.Burst,
+		Interval: c.Interval.Duration,
+	}
+}
+
+// Duration is a time.Duration that is written as a string such as "30s" in TOML.
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler interface.
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	d.Duration = v
+	return nil
 }
 
 // CommonConfig is the configration of common category.
@@ -42,6 +195,11 @@ type Config struct {
 	Common     CommonConfig     `toml:"common"`
 	Mattermost MattermostConfig `toml:"mattermost"`
 	Server     ServerConfig     `toml:"server"`
+	Robot      RobotConfig      `toml:"robot"`
+	Brain      BrainConfig      `toml:"brain"`
+
+	// Members of groups for handler permissions by group name
+	Groups map[string][]string `toml:"groups"`
 }
 
 // LoadConfigFile loads configuration file and returns Config.
@@ -62,18 +220,76 @@ func LoadConfigFile(filename string) (*Config, error) {
 // Validate validates configuration values.
 func (c *Config) Validate() []error {
 	var errs = make([]error, 0)
-	if c.Mattermost.OutgoingURL == "" {
-		errs = append(errs, errors.New(`"mattermost.outgoing_url" is required`))
+	errs = append(errs, c.Mattermost.validate("mattermost")...)
+	names := map[string]bool{mmbot.DefaultAdapterName: true}
+	for i, m := range c.Mattermost.Additional {
+		prefix := fmt.Sprintf("mattermost[%d]", i+1)
+		switch {
+		case m.Name == "":
+			errs = append(errs, fmt.Errorf(`"%s.name" is required`, prefix))
+		case names[m.Name]:
+			errs = append(errs, fmt.Errorf(`"%s.name" is duplicated: %q`, prefix, m.Name))
+		}
+		names[m.Name] = true
+		if m.UserName != "" && m.UserName != c.Mattermost.UserName {
+			// the robot has one name for mentions and its own messages
+			errs = append(errs, fmt.Errorf(`"%s.username" must be the same as "mattermost.username": %q`, prefix, m.UserName))
+		}
+		errs = append(errs, m.validate(prefix)...)
 	}
+	errs = append(errs, c.validateWebhookPaths()...)
 	if c.Mattermost.UserName == "" {
 		errs = append(errs, errors.New(`"mattermost.username" is required`))
 	}
+	switch c.Brain.Backend {
+	case "", BrainMemory:
+	case BrainFile:
+		if c.Brain.Path == "" {
+			errs = append(errs, errors.New(`"brain.path" is required`))
+		}
+	default:
+		errs = append(errs, fmt.Errorf(`Unknown "brain.backend": %q`, c.Brain.Backend))
+	}
 	if len(errs) > 0 {
 		return errs
 	}
 	return nil
 }
 
+// validateWebhookPaths checks that the webhook adapters do not share a path,
+// because all of them are mounted on the same HTTP server.
+func (c *Config) validateWebhookPaths() []error {
+	var errs []error
+	paths := make(map[string]bool)
+	check := func(name string, path string) {
+		if paths[path] {
+			errs = append(errs, fmt.Errorf(`"%s" is duplicated: %q`, name, path))
+		}
+		paths[path] = true
+	}
+
+	blocks := append([]MattermostConfig{c.Mattermost}, c.Mattermost.Additional...)
+	for i, m := range blocks {
+		if m.Adapter != "" && m.Adapter != AdapterWebhook {
+			continue
+		}
+		prefix := "mattermost"
+		if i > 0 {
+			prefix = fmt.Sprintf("mattermost[%d]", i)
+		}
+
+		path := m.IncomingPath
+		if path == "" {
+			path = "/"
+		}
+		check(prefix+".incoming_path", path)
+		if m.CommandPath != "" {
+			check(prefix+".command_path", m.CommandPath)
+		}
+	}
+	return errs
+}
+
 // ValidateAndExitOnError validates configuration values.
 // Print log and exit if errors exist.
 func (c *Config) ValidateAndExitOnError() {
@@ -85,24 +301,40 @@ func (c *Config) ValidateAndExitOnError() {
 	}
 }
 
-// AdapterConfig returns mmhook.Config.
+// AdapterConfig returns adapter.Config of the default adapter.
 func (c *Config) AdapterConfig() *adapter.Config {
-	return &adapter.Config{
-		OutgoingURL:        c.Mattermost.OutgoingURL,
-		IncomingPath:       c.Mattermost.IncomingPath,
-		Tokens:             c.Mattermost.Tokens,
-		OverrideUserName:   c.Mattermost.OverrideUserName,
-		IconURL:            c.Mattermost.IconURL,
-		InsecureSkipVerify: c.Mattermost.InsecureSkipVerify,
-	}
+	return c.Mattermost.AdapterConfig()
 }
 
 // RobotConfig returns mmbot.Config.
 func (c *Config) RobotConfig() *mmbot.Config {
 	return &mmbot.Config{
-		UserName:      c.Mattermost.UserName,
-		BindAddress:   c.Server.BindAddress,
-		Port:          c.Server.Port,
-		DisableServer: !c.Server.Enable,
+		UserName:        c.Mattermost.UserName,
+		BindAddress:     c.Server.BindAddress,
+		Port:            c.Server.Port,
+		DisableServer:   !c.Server.Enable,
+		PublicURL:       c.Server.PublicURL,
+		ActionPath:      c.Server.ActionPath,
+		DialogPath:      c.Server.DialogPath,
+		ActionSecret:    c.Server.ActionSecret,
+		Workers:         c.Robot.Workers,
+		QueueSize:       c.Robot.QueueSize,
+		OverflowPolicy:  c.Robot.OverflowPolicy,
+		RejectMessage:   c.Robot.RejectMessage,
+		HandlerTimeout:  c.Robot.HandlerTimeout.Duration,
+		DrainTimeout:    c.Robot.DrainTimeout.Duration,
+		ShutdownTimeout: c.Robot.ShutdownTimeout.Duration,
+
+		ConversationTimeout: c.Robot.ConversationTimeout.Duration,
+
+		Groups:        c.Groups,
+		PersistGroups: c.Robot.PersistGroups,
+		DenyMessage:   c.Robot.DenyMessage,
+
+		UserLimit:       c.Robot.UserLimit.TriggerLimit(),
+		ChannelLimit:    c.Robot.ChannelLimit.TriggerLimit(),
+		HandlerLimit:    c.Robot.HandlerLimit.TriggerLimit(),
+		LimitPolicy:     c.Robot.LimitPolicy,
+		CooldownMessage: c.Robot.CooldownMessage,
 	}
 }
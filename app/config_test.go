@@ -0,0 +1,102 @@
+package app
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func loadTestConfig(t *testing.T, text string) *Config {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "mmbot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "mmbot.toml")
+	if err := ioutil.WriteFile(path, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config, err := LoadConfigFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return config
+}
+
+func TestValidateMultipleAdapters(t *testing.T) {
+	const first = `
+[[mattermost]]
+adapter = "api"
+server_url = "http://localhost:8065"
+access_token = "token"
+username = "mmbot"
+`
+
+	tests := []struct {
+		name   string
+		second string
+		errs   []string
+	}{
+		{
+			name: "same username",
+			second: `
+[[mattermost]]
+name = "other"
+adapter = "api"
+server_url = "http://other.example.com"
+access_token = "token"
+username = "mmbot"
+`,
+		},
+		{
+			name: "username omitted",
+			second: `
+[[mattermost]]
+name = "other"
+adapter = "api"
+server_url = "http://other.example.com"
+access_token = "token"
+`,
+		},
+		{
+			name: "different username",
+			second: `
+[[mattermost]]
+name = "other"
+adapter = "api"
+server_url = "http://other.example.com"
+access_token = "token"
+username = "otherbot"
+`,
+			errs: []string{`"mattermost[1].username" must be the same as "mattermost.username": "otherbot"`},
+		},
+		{
+			name: "name omitted",
+			second: `
+[[mattermost]]
+outgoing_url = "http://localhost:8065/hooks/abc"
+`,
+			errs: []string{`"mattermost[1].name" is required`},
+		},
+	}
+	for _, tt := range tests {
+		config := loadTestConfig(t, first+tt.second)
+		if len(config.Mattermost.Additional) != 1 {
+			t.Errorf("%s: %d additional adapters, want 1", tt.name, len(config.Mattermost.Additional))
+			continue
+		}
+
+		var got []string
+		for _, err := range config.Validate() {
+			got = append(got, err.Error())
+		}
+		if strings.Join(got, "\n") != strings.Join(tt.errs, "\n") {
+			t.Errorf("%s: Validate() = %q, want %q", tt.name, got, tt.errs)
+		}
+	}
+}
@@ -1,11 +1,16 @@
 package app
 
 import (
+	"log"
 	"os"
 	"path/filepath"
 
 	"github.com/VividCortex/godaemon"
 	"github.com/codegangsta/cli"
+	"github.com/yukithm/mmbot/adapter"
+	"github.com/yukithm/mmbot/brain"
+	"github.com/yukithm/mmbot/mmapi"
+	"github.com/yukithm/mmbot/mmhook"
 )
 
 func (app *App) updateConfigByFlags(c *cli.Context) {
@@ -21,12 +26,24 @@ func (app *App) updateConfigByFlags(c *cli.Context) {
 	if c.IsSet("outgoing-url") {
 		app.Config.Mattermost.OutgoingURL = c.String("outgoing-url")
 	}
+	if c.IsSet("adapter") {
+		app.Config.Mattermost.Adapter = c.String("adapter")
+	}
 	if c.IsSet("incoming-path") {
 		app.Config.Mattermost.IncomingPath = c.String("incoming-path")
 	}
 	if c.IsSet("tokens") {
 		app.Config.Mattermost.Tokens = c.StringSlice("token")
 	}
+	if c.IsSet("server-url") {
+		app.Config.Mattermost.ServerURL = c.String("server-url")
+	}
+	if c.IsSet("access-token") {
+		app.Config.Mattermost.AccessToken = c.String("access-token")
+	}
+	if c.IsSet("team") {
+		app.Config.Mattermost.TeamName = c.String("team")
+	}
 	if c.IsSet("username") {
 		app.Config.Mattermost.UserName = c.String("username")
 	}
@@ -50,6 +67,42 @@ func (app *App) updateConfigByFlags(c *cli.Context) {
 	}
 }
 
+func (app *App) newAdapter(logger *log.Logger) adapter.Adapter {
+	return newAdapter(&app.Config.Mattermost, logger)
+}
+
+// newAdditionalAdapters returns the additional adapters by name.
+func (app *App) newAdditionalAdapters(logger *log.Logger) map[string]adapter.Adapter {
+	if len(app.Config.Mattermost.Additional) == 0 {
+		return nil
+	}
+
+	adapters := make(map[string]adapter.Adapter, len(app.Config.Mattermost.Additional))
+	for i := range app.Config.Mattermost.Additional {
+		m := &app.Config.Mattermost.Additional[i]
+		adapters[m.Name] = newAdapter(m, logger)
+	}
+	return adapters
+}
+
+func newAdapter(c *MattermostConfig, logger *log.Logger) adapter.Adapter {
+	if c.Adapter == AdapterAPI {
+		return mmapi.NewClient(c.AdapterConfig(), logger)
+	}
+	return mmhook.NewClient(c.AdapterConfig(), logger)
+}
+
+func (app *App) newBrain() (brain.Brain, error) {
+	if app.Config.Brain.Backend == BrainFile {
+		path, err := absPath(app.Config.Brain.Path)
+		if err != nil {
+			return nil, err
+		}
+		return brain.OpenFile(path)
+	}
+	return brain.NewMemory(), nil
+}
+
 func (app *App) newLogger() (*Logger, error) {
 	c := app.Config.Common
 	if c.daemonize && (c.Log == "" || c.Log == "-") {
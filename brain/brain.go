@@ -0,0 +1,40 @@
+// Package brain defines Brain interface that is a key-value storage for mmbot.
+package brain
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned when the key does not exist or has expired.
+var ErrNotFound = errors.New("brain: key not found")
+
+// Brain is a key-value storage shared by handlers, jobs and routes.
+type Brain interface {
+	// Get returns the value of the key.
+	// It returns ErrNotFound if the key does not exist.
+	Get(key string) ([]byte, error)
+
+	// Set stores the value of the key. The key never expires.
+	Set(key string, value []byte) error
+
+	// SetWithTTL stores the value of the key that expires after ttl.
+	SetWithTTL(key string, value []byte, ttl time.Duration) error
+
+	// Incr adds delta to the integer value of the key and returns the new value.
+	// A missing key is treated as 0.
+	Incr(key string, delta int64) (int64, error)
+
+	// Delete removes the key. It is not an error if the key does not exist.
+	Delete(key string) error
+
+	// Keys returns sorted keys that begin with the prefix.
+	Keys(prefix string) ([]string, error)
+
+	// TTL returns the remaining time to live of the key.
+	// It returns 0 if the key never expires, or ErrNotFound if the key does not exist.
+	TTL(key string) (time.Duration, error)
+
+	// Close releases the storage.
+	Close() error
+}
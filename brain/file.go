@@ -0,0 +1,139 @@
+package brain
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// File is a Brain that keeps values in memory and writes a JSON snapshot file on every change.
+type File struct {
+	*Memory
+	path string
+	mu   sync.Mutex // serializes writing the snapshot
+}
+
+type fileEntry struct {
+	Value   []byte     `json:"value"`
+	Expires *time.Time `json:"expires,omitempty"`
+}
+
+// OpenFile loads the snapshot file and returns new File brain.
+// The file is created on the first change if it does not exist.
+func OpenFile(path string) (*File, error) {
+	f := &File{
+		Memory: NewMemory(),
+		path:   path,
+	}
+	if err := f.load(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Set stores the value of the key. The key never expires.
+func (f *File) Set(key string, value []byte) error {
+	return f.SetWithTTL(key, value, 0)
+}
+
+// SetWithTTL stores the value of the key that expires after ttl.
+func (f *File) SetWithTTL(key string, value []byte, ttl time.Duration) error {
+	if err := f.Memory.SetWithTTL(key, value, ttl); err != nil {
+		return err
+	}
+	return f.save()
+}
+
+// Incr adds delta to the integer value of the key and returns the new value.
+func (f *File) Incr(key string, delta int64) (int64, error) {
+	n, err := f.Memory.Incr(key, delta)
+	if err != nil {
+		return 0, err
+	}
+	return n, f.save()
+}
+
+// Delete removes the key.
+func (f *File) Delete(key string) error {
+	if err := f.Memory.Delete(key); err != nil {
+		return err
+	}
+	return f.save()
+}
+
+// Close writes the snapshot file.
+func (f *File) Close() error {
+	return f.save()
+}
+
+func (f *File) load() error {
+	buf, err := ioutil.ReadFile(f.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var entries map[string]fileEntry
+	if err := json.Unmarshal(buf, &entries); err != nil {
+		return err
+	}
+
+	f.Memory.mu.Lock()
+	defer f.Memory.mu.Unlock()
+	for key, fe := range entries {
+		e := &entry{value: fe.Value}
+		if fe.Expires != nil {
+			e.expires = *fe.Expires
+		}
+		f.Memory.entries[key] = e
+	}
+
+	return nil
+}
+
+// save writes the snapshot to a temporary file and renames it to the path.
+func (f *File) save() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.Memory.mu.Lock()
+	now := f.Memory.now()
+	entries := make(map[string]fileEntry, len(f.Memory.entries))
+	for key, e := range f.Memory.entries {
+		if e.expired(now) {
+			continue
+		}
+		fe := fileEntry{Value: e.value}
+		if !e.expires.IsZero() {
+			expires := e.expires
+			fe.Expires = &expires
+		}
+		entries[key] = fe
+	}
+	f.Memory.mu.Unlock()
+
+	buf, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(f.path), filepath.Base(f.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(buf); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), f.path)
+}
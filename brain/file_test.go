@@ -0,0 +1,106 @@
+package brain_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/yukithm/mmbot/brain"
+)
+
+func tempFile(t *testing.T) (string, func()) {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "brain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, "brain.json"), func() { os.RemoveAll(dir) }
+}
+
+func TestFileReload(t *testing.T) {
+	path, cleanup := tempFile(t)
+	defer cleanup()
+
+	f, err := brain.OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("snapshot exists before any change: %v", err)
+	}
+	f.Set("greeting", []byte("hello"))
+	f.Set("deleted", []byte("bye"))
+	f.Delete("deleted")
+	f.Incr("count", 3)
+	f.SetWithTTL("session", []byte("abc"), time.Hour)
+	f.SetWithTTL("expired", []byte("old"), time.Nanosecond)
+	time.Sleep(time.Millisecond)
+
+	// the snapshot is written on every change, so Close is not required
+	f, err = brain.OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	tests := []struct {
+		key   string
+		want  string
+		found bool
+	}{
+		{"greeting", "hello", true},
+		{"count", "3", true},
+		{"session", "abc", true},
+		{"deleted", "", false},
+		{"expired", "", false},
+	}
+	for _, tt := range tests {
+		got, err := f.Get(tt.key)
+		if found := err == nil; found != tt.found || string(got) != tt.want {
+			t.Errorf("Get(%q) = %q, %v, want %q (found=%t)", tt.key, got, err, tt.want, tt.found)
+		}
+	}
+	if remain, err := f.TTL("session"); err != nil || remain <= 0 || remain > time.Hour {
+		t.Errorf("TTL() of the reloaded key = %s, %v, want within %s", remain, err, time.Hour)
+	}
+}
+
+func TestFileClock(t *testing.T) {
+	path, cleanup := tempFile(t)
+	defer cleanup()
+
+	f, err := brain.OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &clock{now: time.Now()}
+	f.Clock = c.Now
+
+	f.SetWithTTL("session", []byte("abc"), time.Minute)
+	c.now = c.now.Add(time.Minute)
+	f.Set("other", nil)
+
+	// expired keys are not written to the snapshot
+	f, err = brain.OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys, _ := f.Keys(""); len(keys) != 1 || keys[0] != "other" {
+		t.Errorf("Keys() = %q, want %q", keys, []string{"other"})
+	}
+}
+
+func TestOpenFileInvalid(t *testing.T) {
+	path, cleanup := tempFile(t)
+	defer cleanup()
+
+	if err := ioutil.WriteFile(path, []byte("{invalid"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := brain.OpenFile(path); err == nil {
+		t.Error("OpenFile() of an invalid snapshot succeeded")
+	}
+}
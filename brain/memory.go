@@ -0,0 +1,167 @@
+package brain
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type entry struct {
+	value   []byte
+	expires time.Time // zero means never expires
+}
+
+func (e *entry) expired(now time.Time) bool {
+	return !e.expires.IsZero() && !now.Before(e.expires)
+}
+
+// Memory is an in-memory Brain. Stored values are lost when the process exits.
+type Memory struct {
+	Clock func() time.Time // current time for expiration (default: time.Now)
+
+	mu      sync.Mutex
+	entries map[string]*entry
+}
+
+// NewMemory returns new in-memory Brain.
+func NewMemory() *Memory {
+	return &Memory{
+		entries: make(map[string]*entry),
+	}
+}
+
+// Get returns the value of the key.
+func (m *Memory) Get(key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.lookup(key)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return copyBytes(e.value), nil
+}
+
+// Set stores the value of the key. The key never expires.
+func (m *Memory) Set(key string, value []byte) error {
+	return m.SetWithTTL(key, value, 0)
+}
+
+// SetWithTTL stores the value of the key that expires after ttl.
+// The key never expires if ttl is 0 or less.
+func (m *Memory) SetWithTTL(key string, value []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e := &entry{value: copyBytes(value)}
+	if ttl > 0 {
+		e.expires = m.now().Add(ttl)
+	}
+	m.entries[key] = e
+	return nil
+}
+
+// Incr adds delta to the integer value of the key and returns the new value.
+// The expiration of the key is kept.
+func (m *Memory) Incr(key string, delta int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.lookup(key)
+	if !ok {
+		e = &entry{}
+		m.entries[key] = e
+	}
+
+	var n int64
+	if len(e.value) > 0 {
+		var err error
+		n, err = strconv.ParseInt(string(e.value), 10, 64)
+		if err != nil {
+			return 0, err
+		}
+	}
+	n += delta
+	e.value = []byte(strconv.FormatInt(n, 10))
+	return n, nil
+}
+
+// Delete removes the key.
+func (m *Memory) Delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.entries, key)
+	return nil
+}
+
+// Keys returns sorted keys that begin with the prefix.
+func (m *Memory) Keys(prefix string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	keys := make([]string, 0)
+	for key, e := range m.entries {
+		if e.expired(now) {
+			delete(m.entries, key)
+			continue
+		}
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// TTL returns the remaining time to live of the key.
+func (m *Memory) TTL(key string) (time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.lookup(key)
+	if !ok {
+		return 0, ErrNotFound
+	}
+	if e.expires.IsZero() {
+		return 0, nil
+	}
+	return e.expires.Sub(m.now()), nil
+}
+
+// Close does nothing.
+func (m *Memory) Close() error {
+	return nil
+}
+
+// lookup returns the entry of the key. m.mu must be locked by the caller.
+func (m *Memory) lookup(key string) (*entry, bool) {
+	e, ok := m.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if e.expired(m.now()) {
+		delete(m.entries, key)
+		return nil, false
+	}
+	return e, true
+}
+
+func (m *Memory) now() time.Time {
+	if m.Clock != nil {
+		return m.Clock()
+	}
+	return time.Now()
+}
+
+func copyBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	c := make([]byte, len(b))
+	copy(c, b)
+	return c
+}
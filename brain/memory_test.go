@@ -0,0 +1,163 @@
+package brain_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/yukithm/mmbot/brain"
+)
+
+// clock is a frozen clock for expiration.
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+func newMemory() (*brain.Memory, *clock) {
+	c := &clock{now: time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)}
+	m := brain.NewMemory()
+	m.Clock = c.Now
+	return m, c
+}
+
+func TestMemoryGetSet(t *testing.T) {
+	m, _ := newMemory()
+
+	if _, err := m.Get("missing"); err != brain.ErrNotFound {
+		t.Errorf("Get() of a missing key = %v, want %v", err, brain.ErrNotFound)
+	}
+
+	value := []byte("value")
+	if err := m.Set("key", value); err != nil {
+		t.Fatal(err)
+	}
+	value[0] = 'X'
+	got, err := m.Get("key")
+	if err != nil || string(got) != "value" {
+		t.Errorf("Get() = %q, %v, want %q", got, err, "value")
+	}
+	got[0] = 'X'
+	if got, _ := m.Get("key"); string(got) != "value" {
+		t.Errorf("Get() after modifying the result = %q, want %q", got, "value")
+	}
+
+	if err := m.Delete("key"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Get("key"); err != brain.ErrNotFound {
+		t.Errorf("Get() after Delete() = %v, want %v", err, brain.ErrNotFound)
+	}
+	if err := m.Delete("key"); err != nil {
+		t.Errorf("Delete() of a missing key = %v", err)
+	}
+}
+
+func TestMemoryTTL(t *testing.T) {
+	tests := []struct {
+		name    string
+		ttl     time.Duration
+		elapsed time.Duration
+		found   bool
+		remain  time.Duration
+	}{
+		{"never expires", 0, 24 * time.Hour, true, 0},
+		{"negative ttl", -time.Second, 24 * time.Hour, true, 0},
+		{"before expiration", time.Minute, 59 * time.Second, true, time.Second},
+		{"at expiration", time.Minute, time.Minute, false, 0},
+		{"after expiration", time.Minute, time.Hour, false, 0},
+	}
+	for _, tt := range tests {
+		m, c := newMemory()
+		if err := m.SetWithTTL("key", []byte("value"), tt.ttl); err != nil {
+			t.Fatal(err)
+		}
+		c.now = c.now.Add(tt.elapsed)
+
+		_, err := m.Get("key")
+		if found := err == nil; found != tt.found {
+			t.Errorf("%s: Get() = %v, want found=%t", tt.name, err, tt.found)
+		}
+		remain, err := m.TTL("key")
+		if !tt.found {
+			if err != brain.ErrNotFound {
+				t.Errorf("%s: TTL() = %v, want %v", tt.name, err, brain.ErrNotFound)
+			}
+			continue
+		}
+		if err != nil || remain != tt.remain {
+			t.Errorf("%s: TTL() = %s, %v, want %s", tt.name, remain, err, tt.remain)
+		}
+	}
+}
+
+func TestMemoryIncr(t *testing.T) {
+	m, c := newMemory()
+
+	tests := []struct {
+		delta int64
+		want  int64
+	}{
+		{1, 1},
+		{5, 6},
+		{-10, -4},
+	}
+	for _, tt := range tests {
+		if n, err := m.Incr("count", tt.delta); err != nil || n != tt.want {
+			t.Errorf("Incr(%d) = %d, %v, want %d", tt.delta, n, err, tt.want)
+		}
+	}
+	if got, _ := m.Get("count"); string(got) != "-4" {
+		t.Errorf("Get() = %q, want %q", got, "-4")
+	}
+
+	m.Set("text", []byte("abc"))
+	if _, err := m.Incr("text", 1); err == nil {
+		t.Error("Incr() of a non-integer value succeeded")
+	}
+
+	// Incr keeps the expiration, and an expired key starts from 0
+	m.SetWithTTL("limited", []byte("10"), time.Minute)
+	if n, _ := m.Incr("limited", 1); n != 11 {
+		t.Errorf("Incr() = %d, want 11", n)
+	}
+	if remain, _ := m.TTL("limited"); remain != time.Minute {
+		t.Errorf("TTL() after Incr() = %s, want %s", remain, time.Minute)
+	}
+	c.now = c.now.Add(time.Minute)
+	if n, _ := m.Incr("limited", 1); n != 1 {
+		t.Errorf("Incr() of an expired key = %d, want 1", n)
+	}
+	if remain, _ := m.TTL("limited"); remain != 0 {
+		t.Errorf("TTL() of the new key = %s, want 0", remain)
+	}
+}
+
+func TestMemoryKeys(t *testing.T) {
+	m, c := newMemory()
+	m.Set("user/bob", nil)
+	m.Set("user/alice", nil)
+	m.SetWithTTL("user/carol", nil, time.Minute)
+	m.Set("channel/town-square", nil)
+
+	tests := []struct {
+		prefix  string
+		elapsed time.Duration
+		want    []string
+	}{
+		{"user/", 0, []string{"user/alice", "user/bob", "user/carol"}},
+		{"", 0, []string{"channel/town-square", "user/alice", "user/bob", "user/carol"}},
+		{"group/", 0, []string{}},
+		{"user/", time.Minute, []string{"user/alice", "user/bob"}},
+	}
+	for _, tt := range tests {
+		c.now = c.now.Add(tt.elapsed)
+		keys, err := m.Keys(tt.prefix)
+		if err != nil || !reflect.DeepEqual(keys, tt.want) {
+			t.Errorf("Keys(%q) = %q, %v, want %q", tt.prefix, keys, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,506 @@
+package mmbot
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"unicode"
+
+	"github.com/yukithm/mmbot/message"
+)
+
+// ArgType is a value type of command arguments and flags.
+type ArgType int
+
+const (
+	// StringArg is a string value.
+	StringArg ArgType = iota
+
+	// IntArg is an int value.
+	IntArg
+
+	// FloatArg is a float64 value.
+	FloatArg
+
+	// BoolArg is a bool value ("true", "false", "yes", "no", "on", "off", "1", "0").
+	BoolArg
+
+	// DurationArg is a time.Duration value (e.g. "1h30m").
+	DurationArg
+)
+
+func (t ArgType) String() string {
+	switch t {
+	case IntArg:
+		return "int"
+	case FloatArg:
+		return "float"
+	case BoolArg:
+		return "bool"
+	case DurationArg:
+		return "duration"
+	default:
+		return "string"
+	}
+}
+
+func (t ArgType) parse(s string) (interface{}, error) {
+	var v interface{}
+	var err error
+	switch t {
+	case IntArg:
+		v, err = strconv.Atoi(s)
+	case FloatArg:
+		v, err = strconv.ParseFloat(s, 64)
+	case BoolArg:
+		switch strings.ToLower(s) {
+		case "true", "yes", "on", "1":
+			v = true
+		case "false", "no", "off", "0":
+			v = false
+		default:
+			err = errors.New("invalid bool")
+		}
+	case DurationArg:
+		v, err = time.ParseDuration(s)
+	default:
+		v = s
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s value %q", t, s)
+	}
+	return v, nil
+}
+
+// CommandArg is a positional argument of a command.
+type CommandArg struct {
+	Name     string
+	Type     ArgType
+	Optional bool // optional arguments must follow required ones
+
+	// Variadic argument takes all remaining words joined by a space.
+	// It must be the last argument and its type must be StringArg.
+	Variadic bool
+}
+
+// CommandFlag is a flag of a command such as "--env=prod".
+type CommandFlag struct {
+	Name    string
+	Type    ArgType
+	Default string // default value (empty: no default)
+	Usage   string
+}
+
+// Command is a structured command such as "deploy <service> [--env=prod]".
+// Parsed arguments and flags are stored in InMessage.Args.
+type Command struct {
+	Name          string
+	Description   string
+	Args          []CommandArg
+	Flags         []CommandFlag
+	Action        HandlerAction
+	ContextAction ContextHandlerAction // used instead of Action if set
+	Permission    Permission           // who can use the command (default: CommandHandler.Permission)
+}
+
+// Usage returns the usage text of the command.
+func (c *Command) Usage() string {
+	words := []string{c.Name}
+	for _, arg := range c.Args {
+		name := arg.Name
+		if arg.Variadic {
+			name += "..."
+		}
+		if arg.Optional {
+			words = append(words, "["+name+"]")
+		} else {
+			words = append(words, "<"+name+">")
+		}
+	}
+	for _, flag := range c.Flags {
+		switch {
+		case flag.Type == BoolArg:
+			words = append(words, "[--"+flag.Name+"]")
+		case flag.Default != "":
+			words = append(words, fmt.Sprintf("[--%s=%s]", flag.Name, flag.Default))
+		default:
+			words = append(words, fmt.Sprintf("[--%s=<%s>]", flag.Name, flag.Type))
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// Help returns the detailed help text of the command.
+func (c *Command) Help() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "Usage: %s", c.Usage())
+	if c.Description != "" {
+		fmt.Fprintf(&buf, "\n%s", c.Description)
+	}
+	if len(c.Flags) > 0 {
+		buf.WriteString("\nFlags:")
+		for _, flag := range c.Flags {
+			fmt.Fprintf(&buf, "\n  --%s (%s)", flag.Name, flag.Type)
+			if flag.Usage != "" {
+				fmt.Fprintf(&buf, " %s", flag.Usage)
+			}
+			if flag.Default != "" {
+				fmt.Fprintf(&buf, " (default: %s)", flag.Default)
+			}
+		}
+	}
+	return buf.String()
+}
+
+// parse parses the words into Args.
+func (c *Command) parse(words []string) (message.Args, error) {
+	args := make(message.Args)
+	for _, flag := range c.Flags {
+		if flag.Default != "" {
+			v, err := flag.Type.parse(flag.Default)
+			if err != nil {
+				return nil, fmt.Errorf("--%s: %v", flag.Name, err)
+			}
+			args[flag.Name] = v
+		}
+	}
+
+	var positional []string
+	for i := 0; i < len(words); i++ {
+		word := words[i]
+		if word == "--" {
+			positional = append(positional, words[i+1:]...)
+			break
+		}
+		if !strings.HasPrefix(word, "--") || len(word) == 2 {
+			positional = append(positional, word)
+			continue
+		}
+
+		name := word[2:]
+		value := ""
+		hasValue := false
+		if idx := strings.Index(name, "="); idx >= 0 {
+			name, value, hasValue = name[:idx], name[idx+1:], true
+		}
+		flag := c.findFlag(name)
+		if flag == nil {
+			return nil, fmt.Errorf("unknown flag --%s", name)
+		}
+		if !hasValue {
+			if flag.Type == BoolArg {
+				value = "true"
+			} else if i+1 < len(words) {
+				i++
+				value = words[i]
+			} else {
+				return nil, fmt.Errorf("--%s requires a value", name)
+			}
+		}
+		v, err := flag.Type.parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("--%s: %v", name, err)
+		}
+		args[name] = v
+	}
+
+	for i, arg := range c.Args {
+		if i >= len(positional) {
+			if !arg.Optional {
+				return nil, fmt.Errorf("missing argument <%s>", arg.Name)
+			}
+			continue
+		}
+		word := positional[i]
+		if arg.Variadic {
+			word = strings.Join(positional[i:], " ")
+		}
+		v, err := arg.Type.parse(word)
+		if err != nil {
+			return nil, fmt.Errorf("<%s>: %v", arg.Name, err)
+		}
+		args[arg.Name] = v
+	}
+	if n := len(c.Args); len(positional) > n && (n == 0 || !c.Args[n-1].Variadic) {
+		return nil, fmt.Errorf("too many arguments")
+	}
+
+	return args, nil
+}
+
+func (c *Command) findFlag(name string) *CommandFlag {
+	for i := range c.Flags {
+		if c.Flags[i].Name == name {
+			return &c.Flags[i]
+		}
+	}
+	return nil
+}
+
+// CommandHandler is a handler that dispatches structured commands.
+// The first word of the message is the command name and the rest are arguments.
+// The robot answers the built-in "help" command once for all command handlers,
+// listing the commands that the user can use.
+type CommandHandler struct {
+	MessageType message.Type
+	Commands    []Command
+	DisableHelp bool          // hide the commands from the built-in "help" command
+	Priority    int           // higher priority handlers run first
+	Consume     bool          // stop propagation to lower priority handlers after handling
+	Timeout     time.Duration // overrides Config.HandlerTimeout if not zero
+	Dispatch    DispatchMode  // serializes calls of the handler (default: concurrent)
+	Permission  Permission    // who can use the commands (default: everyone)
+	Limit       TriggerLimit  // overrides Config.HandlerLimit if not zero
+}
+
+// HandlerPriority returns the priority of the handler.
+func (h CommandHandler) HandlerPriority() int {
+	return h.Priority
+}
+
+// HandlerTimeout returns the timeout of the handler.
+func (h CommandHandler) HandlerTimeout() time.Duration {
+	return h.Timeout
+}
+
+// HandlerDispatchMode returns the dispatch mode of the handler.
+func (h CommandHandler) HandlerDispatchMode() DispatchMode {
+	return h.Dispatch
+}
+
+// HandlerPermission returns the permission of the command in the message.
+// The permission of the command overrides that of the handler unless it is zero.
+func (h CommandHandler) HandlerPermission(msg *message.InMessage) Permission {
+	if cmd, _, ok := h.matchCommand(msg); ok && cmd != nil && !cmd.Permission.IsZero() {
+		return cmd.Permission
+	}
+	return h.Permission
+}
+
+// HandlerLimit returns the trigger limit of the handler.
+func (h CommandHandler) HandlerLimit() TriggerLimit {
+	return h.Limit
+}
+
+const helpCommandName = "help"
+
+// CanHandle returns true if the handler can process the message.
+func (h CommandHandler) CanHandle(msg *message.InMessage) bool {
+	_, _, ok := h.matchCommand(msg)
+	return ok
+}
+
+// Handle processes a message.
+func (h CommandHandler) Handle(msg *message.InMessage) error {
+	return h.HandleContext(context.Background(), msg)
+}
+
+// HandleContext processes a message with the context.
+// If the arguments are invalid, it replies the error and the usage instead of calling the action.
+func (h CommandHandler) HandleContext(ctx context.Context, msg *message.InMessage) error {
+	cmd, words, ok := h.matchCommand(msg)
+	if !ok {
+		return fmt.Errorf("Cannot handle message: %#v", msg)
+	}
+
+	var err error
+	if args, perr := cmd.parse(words); perr != nil {
+		err = msg.Reply(fmt.Sprintf("%v\nUsage: %s", perr, cmd.Usage()))
+	} else {
+		msg.Args = args
+		if cmd.ContextAction != nil {
+			err = cmd.ContextAction(ctx, msg)
+		} else {
+			err = cmd.Action(msg)
+		}
+	}
+
+	if err == nil && h.Consume {
+		return ErrConsumed
+	}
+	return err
+}
+
+// matchCommand returns the command and its argument words.
+func (h CommandHandler) matchCommand(msg *message.InMessage) (*Command, []string, bool) {
+	if !matchMessageType(h.MessageType, msg.Type) {
+		return nil, nil, false
+	}
+
+	text, ok := messageText(msg)
+	if !ok {
+		return nil, nil, false
+	}
+
+	words, err := splitWords(text)
+	if err != nil || len(words) == 0 {
+		return nil, nil, false
+	}
+
+	name := strings.ToLower(words[0])
+	if cmd := h.findCommand(name); cmd != nil {
+		return cmd, words[1:], true
+	}
+
+	return nil, nil, false
+}
+
+func (h CommandHandler) findCommand(name string) *Command {
+	for i := range h.Commands {
+		if strings.ToLower(h.Commands[i].Name) == name {
+			return &h.Commands[i]
+		}
+	}
+	return nil
+}
+
+// helpHandler is the built-in "help" command of the command handlers in Robot.Handlers.
+// It runs with the default priority after the handlers of the same priority.
+type helpHandler struct {
+	robot    *Robot
+	handlers []CommandHandler // command handlers that enable help
+}
+
+// helpHandler returns the help handler, or nil if no command handler enables help.
+func (r *Robot) helpHandler() Handler {
+	var handlers []CommandHandler
+	for _, handler := range r.Handlers {
+		if h, ok := handler.(CommandHandler); ok && !h.DisableHelp {
+			handlers = append(handlers, h)
+		}
+	}
+	if len(handlers) == 0 {
+		return nil
+	}
+	return helpHandler{robot: r, handlers: handlers}
+}
+
+// CanHandle returns true if the message is "help" for any of the command handlers.
+// A command named "help" is handled by its command handler instead.
+func (h helpHandler) CanHandle(msg *message.InMessage) bool {
+	words, ok := h.matchHelp(msg)
+	if !ok || len(words) == 0 || strings.ToLower(words[0]) != helpCommandName {
+		return false
+	}
+	for _, ch := range h.handlers {
+		if ch.findCommand(helpCommandName) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Handle replies the help of the command, or the list of the commands.
+func (h helpHandler) Handle(msg *message.InMessage) error {
+	words, _ := h.matchHelp(msg)
+	return msg.Reply(h.help(msg, words[1:]))
+}
+
+// matchHelp returns the words of the message if any command handler accepts its type.
+func (h helpHandler) matchHelp(msg *message.InMessage) ([]string, bool) {
+	for _, ch := range h.handlers {
+		if !matchMessageType(ch.MessageType, msg.Type) {
+			continue
+		}
+		text, ok := messageText(msg)
+		if !ok {
+			return nil, false
+		}
+		words, err := splitWords(text)
+		return words, err == nil
+	}
+	return nil, false
+}
+
+// commands returns the commands that the message can use.
+func (h helpHandler) commands(msg *message.InMessage) []*Command {
+	var commands []*Command
+	for _, ch := range h.handlers {
+		if !matchMessageType(ch.MessageType, msg.Type) {
+			continue
+		}
+		for i := range ch.Commands {
+			cmd := &ch.Commands[i]
+			perm := ch.Permission
+			if !cmd.Permission.IsZero() {
+				perm = cmd.Permission
+			}
+			if h.robot.Permitted(perm, msg) {
+				commands = append(commands, cmd)
+			}
+		}
+	}
+	return commands
+}
+
+func (h helpHandler) help(msg *message.InMessage, words []string) string {
+	commands := h.commands(msg)
+	if len(words) > 0 {
+		name := strings.ToLower(words[0])
+		for _, cmd := range commands {
+			if strings.ToLower(cmd.Name) == name {
+				return cmd.Help()
+			}
+		}
+		return fmt.Sprintf("Unknown command %q", words[0])
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("Available commands:\n```\n")
+	tw := tabwriter.NewWriter(&buf, 0, 4, 4, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(tw, "%s\t%s\n", cmd.Usage(), cmd.Description)
+	}
+	fmt.Fprintf(tw, "%s [command]\t%s\n", helpCommandName, "Show help of the command")
+	tw.Flush()
+	buf.WriteString("```")
+
+	return buf.String()
+}
+
+var errUnterminatedQuote = errors.New("unterminated quote")
+
+// splitWords splits the text into words like shell.
+// Words can be quoted by single or double quotes.
+func splitWords(text string) ([]string, error) {
+	var words []string
+	var word bytes.Buffer
+	var quote rune
+	inWord := false
+
+	for _, c := range text {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				word.WriteRune(c)
+			}
+		case c == '"' || c == '\'':
+			quote = c
+			inWord = true
+		case unicode.IsSpace(c):
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(c)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, errUnterminatedQuote
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+
+	return words, nil
+}
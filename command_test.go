@@ -0,0 +1,98 @@
+package mmbot_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/yukithm/mmbot"
+	"github.com/yukithm/mmbot/message"
+	"github.com/yukithm/mmbot/mmbottest"
+)
+
+func noop(msg *message.InMessage) error {
+	return nil
+}
+
+func TestCommandHelp(t *testing.T) {
+	h := mmbottest.New(
+		mmbot.CommandHandler{
+			Commands: []mmbot.Command{
+				{Name: "echo", Description: "Repeat the text", Action: noop},
+				{Name: "deploy", Description: "Deploy", Action: noop, Permission: mmbot.Permission{Users: []string{"admin"}}},
+			},
+		},
+		mmbot.CommandHandler{
+			Commands: []mmbot.Command{{Name: "weather", Description: "Show the weather", Action: noop}},
+		},
+		mmbot.CommandHandler{
+			Commands:    []mmbot.Command{{Name: "secret", Action: noop}},
+			DisableHelp: true,
+		},
+	)
+
+	tests := []struct {
+		user    string
+		text    string
+		want    []string
+		notWant []string
+	}{
+		{"user", "help", []string{"echo", "weather", "help [command]"}, []string{"deploy", "secret"}},
+		{"admin", "help", []string{"echo", "deploy", "weather"}, []string{"secret"}},
+		{"user", "help weather", []string{"Show the weather"}, nil},
+		{"user", "help deploy", []string{`Unknown command "deploy"`}, nil},
+		{"user", "help secret", []string{`Unknown command "secret"`}, nil},
+	}
+	for _, tt := range tests {
+		h.Reset()
+		h.User = tt.user
+		h.Mention(tt.text)
+
+		sent := h.Sent()
+		if len(sent) != 1 {
+			t.Errorf("%s %q: %d replies, want 1", tt.user, tt.text, len(sent))
+			continue
+		}
+		for _, s := range tt.want {
+			if !strings.Contains(sent[0].Text, s) {
+				t.Errorf("%s %q: reply %q does not contain %q", tt.user, tt.text, sent[0].Text, s)
+			}
+		}
+		for _, s := range tt.notWant {
+			if strings.Contains(sent[0].Text, s) {
+				t.Errorf("%s %q: reply %q contains %q", tt.user, tt.text, sent[0].Text, s)
+			}
+		}
+	}
+}
+
+func TestCommandHelpOverridden(t *testing.T) {
+	h := mmbottest.New(
+		mmbot.CommandHandler{
+			Commands: []mmbot.Command{{Name: "echo", Action: noop}},
+		},
+		mmbot.CommandHandler{
+			Commands: []mmbot.Command{
+				{
+					Name: "help",
+					Action: func(msg *message.InMessage) error {
+						return msg.Reply("custom help")
+					},
+				},
+			},
+		},
+	)
+
+	in := h.Mention("help")
+	h.AssertReply(t, in, "custom help")
+	h.AssertSent(t, mmbottest.Expect{Contains: "custom help"})
+}
+
+func TestCommandHelpDisabled(t *testing.T) {
+	h := mmbottest.New(mmbot.CommandHandler{
+		Commands:    []mmbot.Command{{Name: "echo", Action: noop}},
+		DisableHelp: true,
+	})
+
+	h.Mention("help")
+	h.AssertNothingSent(t)
+}
@@ -1,15 +1,54 @@
 package mmbot
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 // Config for the robot.
 type Config struct {
-	UserName      string // Bot account name
-	BindAddress   string // Bind address to listen on
-	Port          int    // Port to listen on
-	DisableServer bool   // Disable HTTP server
+	UserName        string         // Bot account name
+	BindAddress     string         // Bind address to listen on
+	Port            int            // Port to listen on
+	DisableServer   bool           // Disable HTTP server
+	Workers         int            // Number of workers that run handlers (default: 4)
+	QueueSize       int            // Size of the queue of received messages (default: 20)
+	OverflowPolicy  OverflowPolicy // What to do when the queue is full (default: OverflowBlock)
+	RejectMessage   string         // Reply for OverflowReject
+	HandlerTimeout  time.Duration  // Timeout of each handler call (0: no timeout)
+	DrainTimeout    time.Duration  // Timeout to process queued messages on shutdown (default: ShutdownTimeout)
+	ShutdownTimeout time.Duration  // Timeout of each other shutdown phase
+
+	ConversationTimeout time.Duration // Time a conversation waits for the next message (default: 5m)
+
+	PublicURL    string // URL of the bot HTTP server seen from Mattermost (e.g. "http://bot.example.com:8080")
+	ActionPath   string // Path of the callback route of actions (default: "/mmbot/actions")
+	DialogPath   string // Path of the submission route of dialogs (default: "/mmbot/dialogs")
+	ActionSecret string // Secret to verify action callbacks (required for them)
+
+	Groups        map[string][]string // Initial members of groups for Permission by group name
+	PersistGroups bool                // Store groups changed at runtime in Brain
+	DenyMessage   string              // Reply to messages denied by Permission (empty: no reply)
+
+	UserLimit       TriggerLimit // Limit of mentions, direct messages and slash commands per user (zero: unlimited)
+	ChannelLimit    TriggerLimit // Limit of mentions, direct messages and slash commands per channel (zero: unlimited)
+	HandlerLimit    TriggerLimit // Limit of triggers per handler (zero: unlimited)
+	LimitPolicy     LimitPolicy  // What to do when a limit is exceeded (default: LimitIgnore)
+	CooldownMessage string       // Reply for LimitNotify
 }
 
+// Default values of Config.
+const (
+	DefaultWorkers         = 4
+	DefaultQueueSize       = 20
+	DefaultRejectMessage   = "Sorry, I'm too busy now. Please try again later."
+	DefaultShutdownTimeout = 10 * time.Second
+
+	DefaultConversationTimeout = 5 * time.Minute
+
+	DefaultCooldownMessage = "You're sending too fast. Please wait a moment."
+)
+
 // Address returns bind address and port string.
 func (c *Config) Address() string {
 	if c.Port == 0 {
@@ -17,3 +56,66 @@ func (c *Config) Address() string {
 	}
 	return fmt.Sprintf("%s:%d", c.BindAddress, c.Port)
 }
+
+func (c *Config) workers() int {
+	if c.Workers <= 0 {
+		return DefaultWorkers
+	}
+	return c.Workers
+}
+
+func (c *Config) queueSize() int {
+	if c.QueueSize <= 0 {
+		return DefaultQueueSize
+	}
+	return c.QueueSize
+}
+
+func (c *Config) rejectMessage() string {
+	if c.RejectMessage == "" {
+		return DefaultRejectMessage
+	}
+	return c.RejectMessage
+}
+
+func (c *Config) drainTimeout() time.Duration {
+	if c.DrainTimeout == 0 {
+		return c.shutdownTimeout()
+	}
+	return c.DrainTimeout
+}
+
+func (c *Config) actionPath() string {
+	if c.ActionPath == "" {
+		return DefaultActionPath
+	}
+	return c.ActionPath
+}
+
+func (c *Config) dialogPath() string {
+	if c.DialogPath == "" {
+		return DefaultDialogPath
+	}
+	return c.DialogPath
+}
+
+func (c *Config) conversationTimeout() time.Duration {
+	if c.ConversationTimeout == 0 {
+		return DefaultConversationTimeout
+	}
+	return c.ConversationTimeout
+}
+
+func (c *Config) shutdownTimeout() time.Duration {
+	if c.ShutdownTimeout == 0 {
+		return DefaultShutdownTimeout
+	}
+	return c.ShutdownTimeout
+}
+
+func (c *Config) cooldownMessage() string {
+	if c.CooldownMessage == "" {
+		return DefaultCooldownMessage
+	}
+	return c.CooldownMessage
+}
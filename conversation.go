@@ -0,0 +1,372 @@
+package mmbot
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yukithm/mmbot/message"
+)
+
+// ConversationScope decides which messages continue a conversation.
+type ConversationScope int
+
+const (
+	// ScopeUserChannel continues the conversation with messages from the same user in the same channel (default).
+	ScopeUserChannel ConversationScope = iota
+
+	// ScopeUser continues the conversation with messages from the same user in any channel.
+	ScopeUser
+
+	// ScopeChannel continues the conversation with messages from any user in the same channel.
+	ScopeChannel
+)
+
+// ConversationAction is a function that processes the next message of a conversation.
+// The conversation ends after the action returns unless it calls conv.Next.
+type ConversationAction func(conv *Conversation, msg *message.InMessage) error
+
+// DefaultCancelMessage is replied when a conversation is canceled.
+const DefaultCancelMessage = "Canceled."
+
+// DefaultCancelKeywords are the keywords that cancel a conversation by default.
+var DefaultCancelKeywords = []string{"cancel", "quit"}
+
+// ErrNoConversation is returned when the conversation cannot be continued.
+var ErrNoConversation = errors.New("mmbot: conversation has ended")
+
+// Conversation is a multi-step dialog with users.
+// While the conversation waits for the next message, a message in its scope
+// that matches MessageType and Match goes to the continuation instead of Robot.Handlers.
+// Other messages, and messages that arrive while the continuation is running, go to Robot.Handlers.
+type Conversation struct {
+	Scope          ConversationScope
+	Timeout        time.Duration // time to wait for the next message (default: Config.ConversationTimeout)
+	CancelKeywords []string      // messages that cancel the conversation (default: DefaultCancelKeywords)
+
+	// MessageType is the types of messages that continue the conversation.
+	// The default is the type of Origin, so a conversation started by a mention
+	// continues only with mentions. A conversation started by a slash command
+	// continues with mentions and direct messages.
+	MessageType message.Type
+
+	// Match decides whether the message continues the conversation if it is not nil.
+	// It must not call the methods of conversations.
+	Match func(msg *message.InMessage) bool
+
+	// OnCancel is called when the conversation is canceled by a keyword.
+	// If it is nil, DefaultCancelMessage is replied.
+	OnCancel HandlerAction
+
+	// OnTimeout is called when no message arrives within the timeout.
+	OnTimeout func(conv *Conversation)
+
+	// Values holds the state of the conversation across the steps.
+	Values map[string]interface{}
+
+	// Origin is the message that started the conversation.
+	Origin *message.InMessage
+
+	robot *Robot
+	key   string
+	next  ConversationAction
+	timer *time.Timer
+	gen   int // incremented whenever the timer is replaced
+	ended bool
+}
+
+// conversationTurn is a conversation claimed by a message.
+type conversationTurn struct {
+	conv *Conversation
+	next ConversationAction
+}
+
+type conversations struct {
+	mu    sync.Mutex
+	convs map[string]*Conversation
+}
+
+// StartConversation starts the conversation with the message and waits for the next message.
+// A conversation that already exists in the same scope ends.
+func (r *Robot) StartConversation(msg *message.InMessage, conv *Conversation, next ConversationAction) error {
+	if next == nil {
+		return errors.New("mmbot: conversation requires an action")
+	}
+	if conv.Values == nil {
+		conv.Values = make(map[string]interface{})
+	}
+	conv.Origin = msg
+	conv.robot = r
+	conv.key = conversationKey(conv.Scope, messageUser(msg), messageChannel(msg))
+
+	r.conversations.mu.Lock()
+	defer r.conversations.mu.Unlock()
+
+	if r.conversations.convs == nil {
+		r.conversations.convs = make(map[string]*Conversation)
+	}
+	if old, ok := r.conversations.convs[conv.key]; ok {
+		r.endConversation(old)
+	}
+	r.conversations.convs[conv.key] = conv
+	r.waitConversation(conv, next)
+
+	return nil
+}
+
+// Next waits for the next message and passes it to the action.
+func (c *Conversation) Next(next ConversationAction) error {
+	r := c.robot
+	r.conversations.mu.Lock()
+	defer r.conversations.mu.Unlock()
+
+	if c.ended {
+		return ErrNoConversation
+	}
+	r.waitConversation(c, next)
+	return nil
+}
+
+// End ends the conversation.
+func (c *Conversation) End() {
+	r := c.robot
+	r.conversations.mu.Lock()
+	defer r.conversations.mu.Unlock()
+
+	r.endConversation(c)
+}
+
+// Ended returns true if the conversation has ended.
+func (c *Conversation) Ended() bool {
+	r := c.robot
+	r.conversations.mu.Lock()
+	defer r.conversations.mu.Unlock()
+
+	return c.ended
+}
+
+// waitConversation sets the action and starts the timer.
+// r.conversations.mu must be locked by the caller.
+func (r *Robot) waitConversation(c *Conversation, next ConversationAction) {
+	c.next = next
+	c.gen++
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = r.Config.conversationTimeout()
+	}
+	gen := c.gen
+	c.timer = time.AfterFunc(timeout, func() {
+		r.expireConversation(c, gen)
+	})
+}
+
+// endConversation removes the conversation.
+// r.conversations.mu must be locked by the caller.
+func (r *Robot) endConversation(c *Conversation) {
+	if c.ended {
+		return
+	}
+	c.ended = true
+	c.next = nil
+	c.gen++
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	if r.conversations.convs[c.key] == c {
+		delete(r.conversations.convs, c.key)
+	}
+}
+
+func (r *Robot) expireConversation(c *Conversation, gen int) {
+	r.conversations.mu.Lock()
+	if c.ended || c.gen != gen || c.next == nil {
+		r.conversations.mu.Unlock()
+		return
+	}
+	r.endConversation(c)
+	r.conversations.mu.Unlock()
+
+	r.Logger.Printf("Conversation with %q in %q timed out", c.Origin.UserName, c.Origin.ChannelName)
+	if c.OnTimeout != nil {
+		c.OnTimeout(c)
+	}
+}
+
+// takeConversation claims the conversation that waits for the message.
+// It must be called in order of receipt.
+func (r *Robot) takeConversation(msg *message.InMessage) *conversationTurn {
+	if _, ok := messageText(msg); !ok {
+		return nil
+	}
+
+	r.conversations.mu.Lock()
+	defer r.conversations.mu.Unlock()
+
+	if len(r.conversations.convs) == 0 {
+		return nil
+	}
+
+	user, channel := messageUser(msg), messageChannel(msg)
+	for _, scope := range []ConversationScope{ScopeUserChannel, ScopeUser, ScopeChannel} {
+		c, ok := r.conversations.convs[conversationKey(scope, user, channel)]
+		if !ok || c.next == nil || !c.accepts(msg) {
+			continue
+		}
+
+		turn := &conversationTurn{conv: c, next: c.next}
+		c.next = nil
+		c.gen++
+		c.timer.Stop()
+		return turn
+	}
+
+	return nil
+}
+
+// resumeConversation gives back the turn that was not processed.
+func (r *Robot) resumeConversation(turn *conversationTurn) {
+	if turn == nil {
+		return
+	}
+
+	r.conversations.mu.Lock()
+	defer r.conversations.mu.Unlock()
+
+	if !turn.conv.ended && turn.conv.next == nil {
+		r.waitConversation(turn.conv, turn.next)
+	}
+}
+
+// continueConversation passes the message to the continuation or cancels the conversation.
+func (r *Robot) continueConversation(turn *conversationTurn, msg *message.InMessage) {
+	c := turn.conv
+	defer func() {
+		r.conversations.mu.Lock()
+		defer r.conversations.mu.Unlock()
+		if c.next == nil {
+			r.endConversation(c)
+		}
+	}()
+
+	if c.isCancel(msg) {
+		action := c.OnCancel
+		if action == nil {
+			action = func(msg *message.InMessage) error {
+				return msg.Reply(DefaultCancelMessage)
+			}
+		}
+		r.callHandler(conversationIndex, conversationHandler{func(ctx context.Context, msg *message.InMessage) error {
+			return action(msg)
+		}}, msg, nil)
+		return
+	}
+
+	r.callHandler(conversationIndex, conversationHandler{func(ctx context.Context, msg *message.InMessage) error {
+		return turn.next(c, msg)
+	}}, msg, nil)
+}
+
+// accepts reports whether the message continues the conversation.
+func (c *Conversation) accepts(msg *message.InMessage) bool {
+	if t := c.messageType(); t != message.UnknownMessage && msg.Type&t == 0 {
+		return false
+	}
+	return c.Match == nil || c.Match(msg)
+}
+
+func (c *Conversation) messageType() message.Type {
+	if c.MessageType != message.UnknownMessage {
+		return c.MessageType
+	}
+	if c.Origin.Type == message.CommandMessage {
+		return message.MentionMessage | message.DirectMessage
+	}
+	return c.Origin.Type
+}
+
+func (c *Conversation) isCancel(msg *message.InMessage) bool {
+	text, _ := messageText(msg)
+	text = strings.TrimSpace(text)
+
+	keywords := c.CancelKeywords
+	if keywords == nil {
+		keywords = DefaultCancelKeywords
+	}
+	for _, keyword := range keywords {
+		if strings.EqualFold(text, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// stopConversations ends all conversations.
+func (r *Robot) stopConversations() {
+	r.conversations.mu.Lock()
+	defer r.conversations.mu.Unlock()
+
+	for _, c := range r.conversations.convs {
+		r.endConversation(c)
+	}
+}
+
+// conversationHandler runs a step of a conversation as a handler,
+// so that middlewares and timeouts apply to it.
+type conversationHandler struct {
+	action ContextHandlerAction
+}
+
+func (h conversationHandler) CanHandle(msg *message.InMessage) bool {
+	return true
+}
+
+func (h conversationHandler) Handle(msg *message.InMessage) error {
+	return h.HandleContext(context.Background(), msg)
+}
+
+func (h conversationHandler) HandleContext(ctx context.Context, msg *message.InMessage) error {
+	return h.action(ctx, msg)
+}
+
+func conversationKey(scope ConversationScope, user string, channel string) string {
+	switch scope {
+	case ScopeUser:
+		return "user:" + user
+	case ScopeChannel:
+		return "channel:" + channel
+	default:
+		return "user:" + user + ":channel:" + channel
+	}
+}
+
+// messageUser returns the user ID, or the user name if the ID is unknown.
+// It is qualified by the adapter name because IDs are unique only within a server.
+func messageUser(msg *message.InMessage) string {
+	if msg.UserID != "" {
+		return messageAdapter(msg) + "/" + msg.UserID
+	}
+	return messageAdapter(msg) + "/" + msg.UserName
+}
+
+// messageChannel returns the channel ID, or the channel name if the ID is unknown.
+// It is qualified by the adapter name because IDs are unique only within a server.
+func messageChannel(msg *message.InMessage) string {
+	if msg.ChannelID != "" {
+		return messageAdapter(msg) + "/" + msg.ChannelID
+	}
+	return messageAdapter(msg) + "/" + msg.ChannelName
+}
+
+// messageAdapter returns the name of the adapter that the message came from.
+func messageAdapter(msg *message.InMessage) string {
+	if msg.Adapter == "" {
+		return DefaultAdapterName
+	}
+	return msg.Adapter
+}
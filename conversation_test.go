@@ -0,0 +1,130 @@
+package mmbot_test
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/yukithm/mmbot"
+	"github.com/yukithm/mmbot/message"
+	"github.com/yukithm/mmbot/mmbottest"
+)
+
+// newConversationHarness returns the harness whose "ask" command starts the conversation.
+// Public messages that do not go to the conversation are echoed by a handler.
+func newConversationHarness(conv func() *mmbot.Conversation) *mmbottest.Harness {
+	var h *mmbottest.Harness
+	h = mmbottest.New(
+		mmbot.CommandHandler{
+			MessageType: message.MentionMessage | message.DirectMessage | message.CommandMessage,
+			Commands: []mmbot.Command{
+				{
+					Name: "ask",
+					Action: func(msg *message.InMessage) error {
+						return h.Robot.StartConversation(msg, conv(), func(conv *mmbot.Conversation, msg *message.InMessage) error {
+							return msg.Reply("answer: " + msg.MentionlessText())
+						})
+					},
+				},
+			},
+		},
+		mmbot.PatternHandler{
+			MessageType: message.PublicMessage,
+			Pattern:     regexp.MustCompile(`.+`),
+			Action: func(msg *message.InMessage) error {
+				return msg.Reply("chatter: " + msg.Text)
+			},
+		},
+	)
+	return h
+}
+
+func TestConversationMessageType(t *testing.T) {
+	tests := []struct {
+		name   string
+		conv   mmbot.Conversation
+		start  func(h *mmbottest.Harness)
+		inputs []func(h *mmbottest.Harness) *message.InMessage
+		want   []string
+	}{
+		{
+			name:  "mention origin ignores public messages",
+			start: func(h *mmbottest.Harness) { h.Mention("ask") },
+			inputs: []func(h *mmbottest.Harness) *message.InMessage{
+				func(h *mmbottest.Harness) *message.InMessage { return h.Public("lunch?") },
+				func(h *mmbottest.Harness) *message.InMessage { return h.Public("cancel") },
+				func(h *mmbottest.Harness) *message.InMessage { return h.Mention("42") },
+			},
+			want: []string{"chatter: lunch?", "chatter: cancel", "answer: 42"},
+		},
+		{
+			name:  "channel scope ignores public messages of others",
+			conv:  mmbot.Conversation{Scope: mmbot.ScopeChannel},
+			start: func(h *mmbottest.Harness) { h.Mention("ask") },
+			inputs: []func(h *mmbottest.Harness) *message.InMessage{
+				func(h *mmbottest.Harness) *message.InMessage {
+					return h.Inject(&message.InMessage{Type: message.PublicMessage, UserName: "bob", Text: "hi all"})
+				},
+				func(h *mmbottest.Harness) *message.InMessage {
+					return h.Inject(&message.InMessage{Type: message.MentionMessage, UserName: "bob", Text: "@mmbot 42"})
+				},
+			},
+			want: []string{"chatter: hi all", "answer: 42"},
+		},
+		{
+			name:  "command origin continues with mentions",
+			start: func(h *mmbottest.Harness) { h.Command("/ask") },
+			inputs: []func(h *mmbottest.Harness) *message.InMessage{
+				func(h *mmbottest.Harness) *message.InMessage { return h.Public("lunch?") },
+				func(h *mmbottest.Harness) *message.InMessage { return h.Mention("42") },
+			},
+			want: []string{"chatter: lunch?", "answer: 42"},
+		},
+		{
+			name:  "explicit message type",
+			conv:  mmbot.Conversation{MessageType: message.PublicMessage | message.MentionMessage},
+			start: func(h *mmbottest.Harness) { h.Mention("ask") },
+			inputs: []func(h *mmbottest.Harness) *message.InMessage{
+				func(h *mmbottest.Harness) *message.InMessage { return h.Public("42") },
+			},
+			want: []string{"answer: 42"},
+		},
+		{
+			name: "match",
+			conv: mmbot.Conversation{
+				MessageType: message.PublicMessage,
+				Match: func(msg *message.InMessage) bool {
+					return regexp.MustCompile(`\A\d+\z`).MatchString(msg.Text)
+				},
+			},
+			start: func(h *mmbottest.Harness) { h.Mention("ask") },
+			inputs: []func(h *mmbottest.Harness) *message.InMessage{
+				func(h *mmbottest.Harness) *message.InMessage { return h.Public("lunch?") },
+				func(h *mmbottest.Harness) *message.InMessage { return h.Public("42") },
+			},
+			want: []string{"chatter: lunch?", "answer: 42"},
+		},
+	}
+	for _, tt := range tests {
+		conv := tt.conv
+		h := newConversationHarness(func() *mmbot.Conversation {
+			c := conv
+			return &c
+		})
+		tt.start(h)
+		h.Reset()
+
+		var got []string
+		for _, input := range tt.inputs {
+			in := input(h)
+			for _, msg := range h.Sent() {
+				if msg.InReplyTo != nil && msg.InReplyTo.PostID == in.PostID {
+					got = append(got, strings.TrimPrefix(msg.Text, "@"+in.UserName+" "))
+				}
+			}
+		}
+		if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+			t.Errorf("%s: replies = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
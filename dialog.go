@@ -0,0 +1,386 @@
+package mmbot
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/yukithm/mmbot/adapter"
+	"github.com/yukithm/mmbot/message"
+)
+
+// DefaultDialogPath is the default path of the submission route of dialogs.
+const DefaultDialogPath = "/mmbot/dialogs"
+
+// ErrDialogNotSupported is returned when the adapter cannot open dialogs.
+var ErrDialogNotSupported = errors.New("mmbot: adapter does not support dialogs")
+
+// DialogSubmission is a submission of an interactive dialog.
+// (received from Mattermost)
+type DialogSubmission struct {
+	Type       string                 `json:"type"`
+	CallbackID string                 `json:"callback_id"` // name of the DialogHandler
+	State      string                 `json:"state"`
+	UserID     string                 `json:"user_id"`
+	ChannelID  string                 `json:"channel_id"`
+	TeamID     string                 `json:"team_id"`
+	Submission map[string]interface{} `json:"submission"`
+	Cancelled  bool                   `json:"cancelled"` // the dialog was canceled (Dialog.NotifyOnCancel only)
+
+	// filled by the robot from the message that opened the dialog
+	// (empty if the robot has not received the message of the trigger ID)
+	UserName    string `json:"-"`
+	ChannelName string `json:"-"`
+	Adapter     string `json:"-"`
+}
+
+// message returns the message that represents the submission for permissions and middlewares.
+func (s *DialogSubmission) message() *message.InMessage {
+	return &message.InMessage{
+		ChannelID:   s.ChannelID,
+		ChannelName: s.ChannelName,
+		UserID:      s.UserID,
+		UserName:    s.UserName,
+		Adapter:     s.Adapter,
+		RawMessage:  s,
+	}
+}
+
+// Has returns true if the element has a value.
+func (s *DialogSubmission) Has(name string) bool {
+	v, ok := s.Submission[name]
+	return ok && v != nil
+}
+
+// String returns the value of the element as a string.
+func (s *DialogSubmission) String(name string) string {
+	switch v := s.Submission[name].(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Int returns the value of the element as an int.
+// It returns 0 if the value is not a number.
+func (s *DialogSubmission) Int(name string) int {
+	return int(s.Float(name))
+}
+
+// Float returns the value of the element as a float64.
+// It returns 0 if the value is not a number.
+func (s *DialogSubmission) Float(name string) float64 {
+	switch v := s.Submission[name].(type) {
+	case float64:
+		return v
+	case string:
+		f, _ := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f
+	default:
+		return 0
+	}
+}
+
+// Bool returns the value of the bool element.
+func (s *DialogSubmission) Bool(name string) bool {
+	switch v := s.Submission[name].(type) {
+	case bool:
+		return v
+	case string:
+		b, _ := strconv.ParseBool(v)
+		return b
+	default:
+		return false
+	}
+}
+
+// DialogResponse is a response to a dialog submission.
+// The dialog is closed if it has no errors.
+// (send to Mattermost)
+type DialogResponse struct {
+	Error  string            `json:"error,omitempty"`  // error shown at the bottom of the dialog
+	Errors map[string]string `json:"errors,omitempty"` // errors of the elements by name
+}
+
+// FieldError returns the response that shows the error of the element.
+func FieldError(name string, msg string) *DialogResponse {
+	return &DialogResponse{Errors: map[string]string{name: msg}}
+}
+
+// AddError adds the error of the element.
+func (res *DialogResponse) AddError(name string, msg string) {
+	if res.Errors == nil {
+		res.Errors = make(map[string]string)
+	}
+	res.Errors[name] = msg
+}
+
+// HasErrors returns true if the response has any error.
+func (res *DialogResponse) HasErrors() bool {
+	return res != nil && (res.Error != "" || len(res.Errors) > 0)
+}
+
+// DialogFunc is a function that processes a dialog submission.
+// It can return nil response to close the dialog.
+type DialogFunc func(ctx context.Context, sub *DialogSubmission) (*DialogResponse, error)
+
+// DialogHandler is a handler of dialog submissions.
+// The users and groups of Permission can be checked only if the dialog is opened
+// for the trigger ID of a message or an action that the robot has received.
+type DialogHandler struct {
+	Name       string // name of the dialog that is referred by Robot.OpenDialog
+	Action     DialogFunc
+	Permission Permission // who can submit the dialog (default: everyone)
+}
+
+// dialogTTL is how long the robot accepts the submission of an opened dialog.
+const dialogTTL = time.Hour
+
+// openedDialogs remembers the dialogs that the robot has opened.
+// The state of a dialog is a random token of its record, because Mattermost
+// passes the state through the client of the user.
+type openedDialogs struct {
+	mu      sync.Mutex
+	records map[string]*dialogRecord // token -> record
+}
+
+// dialogRecord is the dialog and the user who opened it.
+// The user is unknown if the trigger ID is not of a received message.
+type dialogRecord struct {
+	name        string
+	userID      string
+	userName    string
+	channelName string
+	adapter     string
+	state       string
+	at          time.Time
+}
+
+// rememberDialog stores the record and returns its token.
+func (r *Robot) rememberDialog(rec *dialogRecord) (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(buf)
+
+	now := r.Now()
+	rec.at = now
+	r.openedDialogs.mu.Lock()
+	defer r.openedDialogs.mu.Unlock()
+
+	if r.openedDialogs.records == nil {
+		r.openedDialogs.records = make(map[string]*dialogRecord)
+	}
+	for t, old := range r.openedDialogs.records {
+		if now.Sub(old.at) >= dialogTTL {
+			delete(r.openedDialogs.records, t)
+		}
+	}
+	r.openedDialogs.records[token] = rec
+	return token, nil
+}
+
+// lookupDialog returns the record of the token, or nil if it is unknown or expired.
+func (r *Robot) lookupDialog(token string) *dialogRecord {
+	r.openedDialogs.mu.Lock()
+	defer r.openedDialogs.mu.Unlock()
+
+	rec, ok := r.openedDialogs.records[token]
+	if !ok || r.Now().Sub(rec.at) >= dialogTTL {
+		return nil
+	}
+	return rec
+}
+
+// forgetDialog removes the record of the closed dialog.
+func (r *Robot) forgetDialog(token string) {
+	r.openedDialogs.mu.Lock()
+	defer r.openedDialogs.mu.Unlock()
+
+	delete(r.openedDialogs.records, token)
+}
+
+// triggerTTL is how long the robot remembers the messages of trigger IDs.
+// Mattermost accepts trigger IDs only for a few seconds.
+const triggerTTL = time.Minute
+
+// triggers remembers the messages that have trigger IDs to open dialogs.
+type triggers struct {
+	mu   sync.Mutex
+	msgs map[string]triggerMessage // trigger ID -> message
+}
+
+type triggerMessage struct {
+	msg *message.InMessage
+	at  time.Time
+}
+
+// rememberTrigger remembers the message that has the trigger ID.
+func (r *Robot) rememberTrigger(msg *message.InMessage) {
+	if msg.TriggerID == "" {
+		return
+	}
+
+	now := r.Now()
+	r.triggers.mu.Lock()
+	defer r.triggers.mu.Unlock()
+
+	if r.triggers.msgs == nil {
+		r.triggers.msgs = make(map[string]triggerMessage)
+	}
+	for id, t := range r.triggers.msgs {
+		if now.Sub(t.at) >= triggerTTL {
+			delete(r.triggers.msgs, id)
+		}
+	}
+	r.triggers.msgs[msg.TriggerID] = triggerMessage{msg: msg, at: now}
+}
+
+// triggerMessage returns the message of the trigger ID, or nil if it is unknown.
+func (r *Robot) triggerMessage(triggerID string) *message.InMessage {
+	r.triggers.mu.Lock()
+	defer r.triggers.mu.Unlock()
+
+	if t, ok := r.triggers.msgs[triggerID]; ok {
+		return t.msg
+	}
+	return nil
+}
+
+// OpenDialog opens the dialog for the trigger ID of a slash command or an action
+// through Robot.Client. The submission is passed to the DialogHandler of the name.
+func (r *Robot) OpenDialog(triggerID string, name string, dialog *message.Dialog) error {
+	return r.OpenDialogVia(DefaultAdapterName, triggerID, name, dialog)
+}
+
+// OpenDialogVia opens the dialog through the adapter of the name (e.g. InMessage.Adapter).
+func (r *Robot) OpenDialogVia(adapterName string, triggerID string, name string, dialog *message.Dialog) error {
+	a, err := r.Adapter(adapterName)
+	if err != nil {
+		return err
+	}
+	client, ok := a.(adapter.DialogAdapter)
+	if !ok {
+		return ErrDialogNotSupported
+	}
+
+	rec := &dialogRecord{
+		name:  name,
+		state: dialog.State,
+	}
+	if msg := r.triggerMessage(triggerID); msg != nil {
+		rec.userID = msg.UserID
+		rec.userName = msg.UserName
+		rec.channelName = msg.ChannelName
+		rec.adapter = msg.Adapter
+	}
+	token, err := r.rememberDialog(rec)
+	if err != nil {
+		return err
+	}
+
+	d := *dialog
+	d.CallbackID = name
+	d.State = token
+	if err := client.OpenDialog(triggerID, r.dialogURL(), &d); err != nil {
+		r.forgetDialog(token)
+		return err
+	}
+	return nil
+}
+
+// dialogURL returns the submission URL of dialogs.
+func (r *Robot) dialogURL() string {
+	return strings.TrimRight(r.Config.PublicURL, "/") + r.Config.dialogPath()
+}
+
+func (r *Robot) mountDialogs(mux *mux.Router) {
+	if len(r.Dialogs) == 0 {
+		return
+	}
+	mux.HandleFunc(r.Config.dialogPath(), r.serveDialog).Methods("POST")
+}
+
+// serveDialog receives a dialog submission and calls the DialogHandler.
+// The submission is accepted only from the user who opened the dialog,
+// and the user and the state are taken from the record of the dialog.
+func (r *Robot) serveDialog(w http.ResponseWriter, req *http.Request) {
+	var sub DialogSubmission
+	if err := json.NewDecoder(req.Body).Decode(&sub); err != nil {
+		r.Logger.Printf("Invalid dialog submission: %v", err)
+		http.Error(w, "400 Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	token := sub.State
+	rec := r.lookupDialog(token)
+	if rec == nil || rec.name != sub.CallbackID || (rec.userID != "" && rec.userID != sub.UserID) {
+		r.Logger.Printf("Invalid dialog submission of %q by %q from %q", sub.CallbackID, sub.UserID, req.RemoteAddr)
+		http.Error(w, "403 Forbidden", http.StatusForbidden)
+		return
+	}
+	sub.State = rec.state
+	sub.UserName = rec.userName
+	sub.ChannelName = rec.channelName
+	sub.Adapter = rec.adapter
+
+	handler := r.findDialog(sub.CallbackID)
+	if handler == nil {
+		r.Logger.Printf("Unknown dialog %q", sub.CallbackID)
+		http.Error(w, "404 Not Found", http.StatusNotFound)
+		return
+	}
+
+	var res *DialogResponse
+	err := r.callCallback(handler.Permission, sub.message(), func(ctx context.Context, msg *message.InMessage) error {
+		var err error
+		res, err = handler.Action(ctx, &sub)
+		return err
+	})
+	switch err {
+	case nil:
+	case ErrAccessDenied:
+		if r.Config.DenyMessage == "" {
+			http.Error(w, "403 Forbidden", http.StatusForbidden)
+			return
+		}
+		res = &DialogResponse{Error: r.Config.DenyMessage}
+	case ErrRateLimited:
+		res = &DialogResponse{Error: r.Config.cooldownMessage()}
+	default:
+		http.Error(w, "500 Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if sub.Cancelled || !res.HasErrors() {
+		r.forgetDialog(token)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		r.Logger.Printf("Failed to write dialog response: %v", err)
+	}
+}
+
+func (r *Robot) findDialog(name string) *DialogHandler {
+	for i := range r.Dialogs {
+		if r.Dialogs[i].Name == name {
+			return &r.Dialogs[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package mmbot
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yukithm/mmbot/message"
+)
+
+// openTestDialog opens the dialog for the slash command of alice and returns its state.
+func openTestDialog(t *testing.T, r *Robot, a *testAdapter) string {
+	t.Helper()
+
+	r.Dispatch(&message.InMessage{
+		Type:        message.CommandMessage,
+		UserID:      "u1",
+		UserName:    "alice",
+		ChannelName: "town-square",
+		Command:     "/report",
+		TriggerID:   "trigger",
+		Text:        "/report",
+	})
+	if err := r.OpenDialog("trigger", "report", &message.Dialog{Title: "Report", State: "client state"}); err != nil {
+		t.Fatal(err)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.dialogs[len(a.dialogs)-1].State
+}
+
+func TestServeDialog(t *testing.T) {
+	r, a := newTestRobot(testSecret)
+	var subs []DialogSubmission
+	r.Dialogs = []DialogHandler{
+		{
+			Name:       "report",
+			Permission: Permission{Users: []string{"alice"}},
+			Action: func(ctx context.Context, sub *DialogSubmission) (*DialogResponse, error) {
+				subs = append(subs, *sub)
+				if sub.String("title") == "" {
+					return FieldError("title", "required"), nil
+				}
+				return nil, nil
+			},
+		},
+	}
+
+	state := openTestDialog(t, r, a)
+	if strings.Contains(state, testSecret) || strings.Contains(state, "alice") || strings.Contains(state, "client state") {
+		t.Errorf("state %q exposes the secret or the record", state)
+	}
+
+	tests := []struct {
+		name   string
+		sub    DialogSubmission
+		status int
+	}{
+		{"tampered state", DialogSubmission{CallbackID: "report", UserID: "u1", State: `{"user_id":"u1","user_name":"alice"}`}, http.StatusForbidden},
+		{"other user", DialogSubmission{CallbackID: "report", UserID: "u2", State: state}, http.StatusForbidden},
+		{"other dialog", DialogSubmission{CallbackID: "deploy", UserID: "u1", State: state}, http.StatusForbidden},
+		{"validation error", DialogSubmission{CallbackID: "report", UserID: "u1", State: state}, http.StatusOK},
+		{"submit", DialogSubmission{CallbackID: "report", UserID: "u1", State: state, Submission: map[string]interface{}{"title": "down"}}, http.StatusOK},
+		{"closed", DialogSubmission{CallbackID: "report", UserID: "u1", State: state, Submission: map[string]interface{}{"title": "down"}}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		if rec := post(r, DefaultDialogPath, &tt.sub); rec.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.name, rec.Code, tt.status)
+		}
+	}
+
+	if len(subs) != 2 {
+		t.Fatalf("action called %d times, want 2", len(subs))
+	}
+	sub := subs[1]
+	if sub.UserName != "alice" || sub.ChannelName != "town-square" || sub.State != "client state" {
+		t.Errorf("submission = %+v, want alice in town-square with the client state", sub)
+	}
+}
+
+func TestServeDialogUnknownOpener(t *testing.T) {
+	r, a := newTestRobot(testSecret)
+	var subs []DialogSubmission
+	r.Dialogs = []DialogHandler{
+		{
+			Name:       "report",
+			Permission: Permission{Users: []string{"alice"}},
+			Action: func(ctx context.Context, sub *DialogSubmission) (*DialogResponse, error) {
+				subs = append(subs, *sub)
+				return nil, nil
+			},
+		},
+	}
+
+	// the robot has not received the message of the trigger ID
+	if err := r.OpenDialog("unknown", "report", &message.Dialog{Title: "Report"}); err != nil {
+		t.Fatal(err)
+	}
+	state := a.dialogs[0].State
+
+	rec := post(r, DefaultDialogPath, &DialogSubmission{CallbackID: "report", UserID: "u1", State: state})
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "denied") || len(subs) != 0 {
+		t.Errorf("status = %d, response = %s, calls = %d, want denied", rec.Code, rec.Body.String(), len(subs))
+	}
+}
+
+func TestServeDialogExpired(t *testing.T) {
+	r, a := newTestRobot(testSecret)
+	now := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	r.Clock = func() time.Time { return now }
+	r.Dialogs = []DialogHandler{
+		{
+			Name: "report",
+			Action: func(ctx context.Context, sub *DialogSubmission) (*DialogResponse, error) {
+				return nil, nil
+			},
+		},
+	}
+
+	state := openTestDialog(t, r, a)
+	now = now.Add(dialogTTL)
+	if rec := post(r, DefaultDialogPath, &DialogSubmission{CallbackID: "report", UserID: "u1", State: state}); rec.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+}
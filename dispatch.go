@@ -0,0 +1,152 @@
+package mmbot
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/yukithm/mmbot/message"
+)
+
+// OverflowPolicy decides what to do with a received message when the worker queue is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock waits until the queue has room. It blocks receiving messages.
+	OverflowBlock OverflowPolicy = iota
+
+	// OverflowDropOldest drops the oldest queued message.
+	OverflowDropOldest
+
+	// OverflowDropNewest drops the received message.
+	OverflowDropNewest
+
+	// OverflowReject drops the received message and replies Config.RejectMessage
+	// if the message is a mention or a direct message.
+	OverflowReject
+)
+
+var overflowPolicyNames = map[OverflowPolicy]string{
+	OverflowBlock:      "block",
+	OverflowDropOldest: "drop_oldest",
+	OverflowDropNewest: "drop_newest",
+	OverflowReject:     "reject",
+}
+
+func (p OverflowPolicy) String() string {
+	if name, ok := overflowPolicyNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("OverflowPolicy(%d)", int(p))
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler interface.
+// It accepts "block", "drop_oldest", "drop_newest" and "reject".
+func (p *OverflowPolicy) UnmarshalText(text []byte) error {
+	name := strings.ToLower(string(text))
+	for policy, n := range overflowPolicyNames {
+		if n == name {
+			*p = policy
+			return nil
+		}
+	}
+	return fmt.Errorf("Unknown overflow policy: %q", text)
+}
+
+// Stats is statistics of message dispatching.
+type Stats struct {
+	Received uint64 // received messages
+	Dropped  uint64 // messages dropped by the overflow policy
+	Rejected uint64 // messages rejected by the overflow policy
+	Queued   int    // messages waiting in the queue
+
+	LimitedUser    uint64 // messages that exceeded Config.UserLimit
+	LimitedChannel uint64 // messages that exceeded Config.ChannelLimit
+	LimitedHandler uint64 // handler triggers that exceeded handler limits
+}
+
+type stats struct {
+	received       uint64
+	dropped        uint64
+	rejected       uint64
+	limitedUser    uint64
+	limitedChannel uint64
+	limitedHandler uint64
+}
+
+// Stats returns statistics of message dispatching.
+func (r *Robot) Stats() Stats {
+	return Stats{
+		Received: atomic.LoadUint64(&r.stats.received),
+		Dropped:  atomic.LoadUint64(&r.stats.dropped),
+		Rejected: atomic.LoadUint64(&r.stats.rejected),
+		Queued:   len(r.workerJobs),
+
+		LimitedUser:    atomic.LoadUint64(&r.stats.limitedUser),
+		LimitedChannel: atomic.LoadUint64(&r.stats.limitedChannel),
+		LimitedHandler: atomic.LoadUint64(&r.stats.limitedHandler),
+	}
+}
+
+// enqueue puts the job into the worker queue according to the overflow policy.
+// It never blocks unless the policy is OverflowBlock.
+func (r *Robot) enqueue(job workerJob) {
+	if r.Config.OverflowPolicy == OverflowBlock {
+		r.workerJobs <- job
+		return
+	}
+
+	select {
+	case r.workerJobs <- job:
+		return
+	default:
+	}
+
+	switch r.Config.OverflowPolicy {
+	case OverflowDropOldest:
+		for {
+			select {
+			case old := <-r.workerJobs:
+				r.drop(old)
+			default:
+			}
+
+			select {
+			case r.workerJobs <- job:
+				return
+			default:
+			}
+		}
+	case OverflowReject:
+		r.reject(job)
+	default:
+		r.drop(job)
+	}
+}
+
+func (r *Robot) drop(job workerJob) {
+	releaseTickets(job.tickets)
+	r.resumeConversation(job.turn)
+	msg := job.message
+
+	atomic.AddUint64(&r.stats.dropped, 1)
+	r.Logger.Printf("Queue is full; drop message from %q in %q", msg.UserName, msg.ChannelName)
+}
+
+func (r *Robot) reject(job workerJob) {
+	releaseTickets(job.tickets)
+	r.resumeConversation(job.turn)
+	msg := job.message
+
+	atomic.AddUint64(&r.stats.rejected, 1)
+	r.Logger.Printf("Queue is full; reject message from %q in %q", msg.UserName, msg.ChannelName)
+
+	if msg.Type&(message.MentionMessage|message.DirectMessage|message.CommandMessage) == 0 {
+		return
+	}
+	go func() {
+		if err := msg.Reply(r.Config.rejectMessage()); err != nil {
+			r.Logger.Print(err)
+		}
+	}()
+}
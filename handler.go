@@ -1,26 +1,123 @@
 package mmbot
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"regexp"
+	"strings"
+	"time"
 
 	"github.com/yukithm/mmbot/message"
 )
 
+// ErrConsumed can be returned by handlers to tell that the message has been consumed.
+// Handlers with lower priority will not receive the message.
+var ErrConsumed = errors.New("mmbot: message consumed")
+
 // Handler is a message handler.
 type Handler interface {
 	CanHandle(*message.InMessage) bool
 	Handle(*message.InMessage) error
 }
 
+// ContextHandler is a message handler that receives a context.
+// The context is canceled when the handler times out or the robot stops.
+// Handlers in Robot.Handlers that implement ContextHandler are called by HandleContext instead of Handle.
+type ContextHandler interface {
+	CanHandle(*message.InMessage) bool
+	HandleContext(context.Context, *message.InMessage) error
+}
+
+// TimeoutHandler is a handler that has its own timeout.
+// It overrides Config.HandlerTimeout unless it returns 0.
+type TimeoutHandler interface {
+	Handler
+	HandlerTimeout() time.Duration
+}
+
+// AdaptHandler returns ContextHandler that calls Handle of the handler, ignoring the context.
+// If the handler already implements ContextHandler, it is returned as is.
+func AdaptHandler(handler Handler) ContextHandler {
+	if h, ok := handler.(ContextHandler); ok {
+		return h
+	}
+	return handlerAdapter{handler}
+}
+
+type handlerAdapter struct {
+	Handler
+}
+
+func (h handlerAdapter) HandleContext(ctx context.Context, msg *message.InMessage) error {
+	return h.Handle(msg)
+}
+
+// WrapContextHandler returns Handler that can be added to Robot.Handlers.
+// The robot calls HandleContext, and Handle calls it with context.Background().
+func WrapContextHandler(handler ContextHandler) Handler {
+	return contextHandlerWrapper{handler}
+}
+
+type contextHandlerWrapper struct {
+	ContextHandler
+}
+
+func (h contextHandlerWrapper) Handle(msg *message.InMessage) error {
+	return h.HandleContext(context.Background(), msg)
+}
+
+// PriorityHandler is a handler that has a priority.
+// Handlers with higher priority receive messages first; handlers that
+// have the same priority run one by one in order of Robot.Handlers. The default priority is 0.
+type PriorityHandler interface {
+	Handler
+	HandlerPriority() int
+}
+
 // HandlerAction is a function that process a message.
 type HandlerAction func(*message.InMessage) error
 
+// ContextHandlerAction is a function that process a message with a context.
+type ContextHandlerAction func(context.Context, *message.InMessage) error
+
 // PatternHandler is a pattern matching handler.
 type PatternHandler struct {
-	MessageType message.Type
-	Pattern     *regexp.Regexp
-	Action      HandlerAction
+	MessageType   message.Type
+	Pattern       *regexp.Regexp
+	Action        HandlerAction
+	ContextAction ContextHandlerAction // used instead of Action if set
+	Priority      int                  // higher priority handlers run first
+	Consume       bool                 // stop propagation to lower priority handlers after handling
+	Timeout       time.Duration        // overrides Config.HandlerTimeout if not zero
+	Dispatch      DispatchMode         // serializes calls of the handler (default: concurrent)
+	Permission    Permission           // who can use the handler (default: everyone)
+	Limit         TriggerLimit         // overrides Config.HandlerLimit if not zero
+}
+
+// HandlerPriority returns the priority of the handler.
+func (h PatternHandler) HandlerPriority() int {
+	return h.Priority
+}
+
+// HandlerTimeout returns the timeout of the handler.
+func (h PatternHandler) HandlerTimeout() time.Duration {
+	return h.Timeout
+}
+
+// HandlerDispatchMode returns the dispatch mode of the handler.
+func (h PatternHandler) HandlerDispatchMode() DispatchMode {
+	return h.Dispatch
+}
+
+// HandlerPermission returns the permission of the handler.
+func (h PatternHandler) HandlerPermission(msg *message.InMessage) Permission {
+	return h.Permission
+}
+
+// HandlerLimit returns the trigger limit of the handler.
+func (h PatternHandler) HandlerLimit() TriggerLimit {
+	return h.Limit
 }
 
 // CanHandle returns true if the handler can process the message.
@@ -31,34 +128,41 @@ func (h PatternHandler) CanHandle(msg *message.InMessage) bool {
 
 // Handle processes a message.
 func (h PatternHandler) Handle(msg *message.InMessage) error {
+	return h.HandleContext(context.Background(), msg)
+}
+
+// HandleContext processes a message with the context.
+func (h PatternHandler) HandleContext(ctx context.Context, msg *message.InMessage) error {
 	matches, ok := h.matchPattern(msg)
 	if !ok {
 		return fmt.Errorf("Cannot handle message: %#v", msg)
 	}
 	msg.Matches = matches
 
-	if err := h.Action(msg); err != nil {
+	var err error
+	if h.ContextAction != nil {
+		err = h.ContextAction(ctx, msg)
+	} else {
+		err = h.Action(msg)
+	}
+	if err != nil {
 		return err
 	}
+	if h.Consume {
+		return ErrConsumed
+	}
 
 	return nil
 }
 
 func (h PatternHandler) matchPattern(msg *message.InMessage) ([]string, bool) {
-	if !h.matchMessageType(msg.Type) {
+	if !matchMessageType(h.MessageType, msg.Type) {
 		return nil, false
 	}
 
-	if msg.Type == message.MentionMessage {
-		mentionName := msg.MentionName()
-		if mentionName != msg.Sender.SenderName() {
-			return nil, false
-		}
-	}
-
-	text := msg.Text
-	if msg.Type == message.MentionMessage {
-		text = msg.MentionlessText()
+	text, ok := messageText(msg)
+	if !ok {
+		return nil, false
 	}
 
 	matches := h.Pattern.FindStringSubmatch(text)
@@ -69,11 +173,29 @@ func (h PatternHandler) matchPattern(msg *message.InMessage) ([]string, bool) {
 	return matches, true
 }
 
-func (h PatternHandler) matchMessageType(t message.Type) bool {
-	if h.MessageType == 0 {
+func matchMessageType(want message.Type, t message.Type) bool {
+	if want == 0 {
 		return true
 	}
-	return t&h.MessageType != 0
+	return t&want != 0
+}
+
+// messageText returns the text for matching.
+// It returns false if the message is a mention to others.
+// The leading "/" of slash commands is trimmed.
+func messageText(msg *message.InMessage) (string, bool) {
+	if msg.Type == message.MentionMessage {
+		mentionName := msg.MentionName()
+		if mentionName != msg.Sender.SenderName() {
+			return "", false
+		}
+		return msg.MentionlessText(), true
+	}
+	if msg.Type == message.CommandMessage {
+		return strings.TrimPrefix(msg.Text, "/"), true
+	}
+
+	return msg.Text, true
 }
 
 func (h PatternHandler) trimBotName(text string, name string) string {
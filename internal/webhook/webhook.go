@@ -0,0 +1,38 @@
+// Package webhook has the translation rules of Mattermost webhooks and slash commands.
+// They are shared by the mmhook adapter and the shell adapter which imitates it.
+package webhook
+
+import (
+	"strings"
+
+	"github.com/yukithm/mmbot/message"
+)
+
+// MessageType returns the type of the message posted to the channel.
+func MessageType(channelName, text string) message.Type {
+	if strings.HasPrefix(channelName, "@") {
+		return message.DirectMessage
+	}
+	if strings.HasPrefix(text, "@") {
+		return message.MentionMessage
+	}
+
+	return message.PublicMessage
+}
+
+// CommandText returns the text of the slash command such as "/echo hello".
+func CommandText(command, text string) string {
+	return strings.TrimSpace(command + " " + text)
+}
+
+// OutChannel returns the channel name to post the message.
+// The channel is taken from the replied or triggering message if any.
+func OutChannel(msg *message.OutMessage) string {
+	if msg.InReplyTo != nil {
+		return msg.InReplyTo.ChannelName
+	}
+	if msg.TriggeredBy != nil {
+		return msg.TriggeredBy.ChannelName
+	}
+	return msg.ChannelName
+}
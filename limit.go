@@ -0,0 +1,180 @@
+package mmbot
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/yukithm/mmbot/message"
+)
+
+// TriggerLimit is a token bucket limit of bot triggers.
+// Burst triggers are allowed at once, and then one every Interval.
+type TriggerLimit struct {
+	Burst    int
+	Interval time.Duration
+}
+
+// IsZero reports whether the limit does not restrict.
+func (l TriggerLimit) IsZero() bool {
+	return l.Burst <= 0 || l.Interval <= 0
+}
+
+// LimitPolicy decides what to do with a message that exceeds a trigger limit.
+type LimitPolicy int
+
+const (
+	// LimitIgnore ignores the message quietly.
+	LimitIgnore LimitPolicy = iota
+
+	// LimitNotify replies Config.CooldownMessage to the first message that
+	// exceeds the limit, and ignores the following ones until the interval passes.
+	LimitNotify
+)
+
+var limitPolicyNames = map[LimitPolicy]string{
+	LimitIgnore: "ignore",
+	LimitNotify: "notify",
+}
+
+func (p LimitPolicy) String() string {
+	if name, ok := limitPolicyNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("LimitPolicy(%d)", int(p))
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler interface.
+// It accepts "ignore" and "notify".
+func (p *LimitPolicy) UnmarshalText(text []byte) error {
+	name := strings.ToLower(string(text))
+	for policy, n := range limitPolicyNames {
+		if n == name {
+			*p = policy
+			return nil
+		}
+	}
+	return fmt.Errorf("Unknown limit policy: %q", text)
+}
+
+// LimitedHandler is a handler that has its own trigger limit.
+// It overrides Config.HandlerLimit unless it returns zero.
+type LimitedHandler interface {
+	Handler
+	HandlerLimit() TriggerLimit
+}
+
+type limiters struct {
+	mu       sync.Mutex
+	user     *rateLimiter
+	channel  *rateLimiter
+	handlers map[int]*rateLimiter // by handler index
+	cooldown map[string]time.Time // exceeded limit and user -> end of the cooldown
+}
+
+// allowMessage checks the user and channel limits of the message.
+// They apply to mentions, direct messages and slash commands.
+// If the message exceeds a limit, notice tells whether to reply the cooldown notice.
+func (r *Robot) allowMessage(msg *message.InMessage) (allowed bool, notice bool) {
+	if msg.Type&(message.MentionMessage|message.DirectMessage|message.CommandMessage) == 0 {
+		return true, false
+	}
+	return r.allowSender(msg)
+}
+
+// allowSender checks the user and channel limits of the message regardless of its type.
+func (r *Robot) allowSender(msg *message.InMessage) (allowed bool, notice bool) {
+	now := r.Now()
+	r.limiters.mu.Lock()
+	defer r.limiters.mu.Unlock()
+
+	if limit := r.Config.UserLimit; !limit.IsZero() {
+		if r.limiters.user == nil {
+			r.limiters.user = newRateLimiter(limit.Burst, limit.Interval)
+		}
+		if !r.limiters.user.allow(messageUser(msg), now) {
+			atomic.AddUint64(&r.stats.limitedUser, 1)
+			return false, r.exceeded("user", msg, limit, now)
+		}
+	}
+	if limit := r.Config.ChannelLimit; !limit.IsZero() {
+		if r.limiters.channel == nil {
+			r.limiters.channel = newRateLimiter(limit.Burst, limit.Interval)
+		}
+		if !r.limiters.channel.allow(messageChannel(msg), now) {
+			atomic.AddUint64(&r.stats.limitedChannel, 1)
+			return false, r.exceeded("channel", msg, limit, now)
+		}
+	}
+	return true, false
+}
+
+// allowHandler checks the limit of the handler, which is shared by all users.
+// If the handler cannot be triggered now, notice tells whether to reply the cooldown notice.
+func (r *Robot) allowHandler(index int, handler Handler, msg *message.InMessage) (allowed bool, notice bool) {
+	if index == conversationIndex {
+		return true, false
+	}
+	limit := r.Config.HandlerLimit
+	if h, ok := handler.(LimitedHandler); ok && !h.HandlerLimit().IsZero() {
+		limit = h.HandlerLimit()
+	}
+	if limit.IsZero() {
+		return true, false
+	}
+
+	now := r.Now()
+	r.limiters.mu.Lock()
+	defer r.limiters.mu.Unlock()
+
+	if r.limiters.handlers == nil {
+		r.limiters.handlers = make(map[int]*rateLimiter)
+	}
+	l, ok := r.limiters.handlers[index]
+	if !ok {
+		l = newRateLimiter(limit.Burst, limit.Interval)
+		r.limiters.handlers[index] = l
+	}
+	if !l.allow("", now) {
+		atomic.AddUint64(&r.stats.limitedHandler, 1)
+		return false, r.exceeded("handler "+strconv.Itoa(index), msg, limit, now)
+	}
+	return true, false
+}
+
+// exceeded logs the first message of the user that exceeds the limit in its cooldown,
+// and reports whether the message should receive the cooldown notice.
+// Following messages are ignored quietly until the interval of the limit passes.
+// r.limiters.mu must be locked by the caller.
+func (r *Robot) exceeded(name string, msg *message.InMessage, limit TriggerLimit, now time.Time) bool {
+	if r.limiters.cooldown == nil {
+		r.limiters.cooldown = make(map[string]time.Time)
+	}
+	key := name + "/" + messageUser(msg)
+	if until, ok := r.limiters.cooldown[key]; ok && now.Before(until) {
+		return false
+	}
+	r.limiters.cooldown[key] = now.Add(limit.Interval)
+
+	if len(r.limiters.cooldown) >= 1024 {
+		for k, until := range r.limiters.cooldown {
+			if !now.Before(until) {
+				delete(r.limiters.cooldown, k)
+			}
+		}
+	}
+
+	r.Logger.Printf("Rate limit of %s exceeded: %q in %q", name, msg.UserName, msg.ChannelName)
+	return r.Config.LimitPolicy == LimitNotify &&
+		msg.Type&(message.MentionMessage|message.DirectMessage|message.CommandMessage) != 0
+}
+
+// notifyCooldown replies Config.CooldownMessage.
+func (r *Robot) notifyCooldown(msg *message.InMessage) {
+	if err := msg.Reply(r.Config.cooldownMessage()); err != nil {
+		r.Logger.Print(err)
+	}
+}
@@ -0,0 +1,142 @@
+package mmbot_test
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/yukithm/mmbot"
+	"github.com/yukithm/mmbot/message"
+	"github.com/yukithm/mmbot/mmbottest"
+)
+
+// limitStep injects a message from the user in the channel after the clock advances.
+type limitStep struct {
+	advance time.Duration
+	user    string
+	channel string
+	public  bool
+	replied bool
+}
+
+func TestTriggerLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		config mmbot.Config
+		steps  []limitStep
+		want   mmbot.Stats
+	}{
+		{
+			name:   "user limit",
+			config: mmbot.Config{UserLimit: mmbot.TriggerLimit{Burst: 2, Interval: 10 * time.Second}},
+			steps: []limitStep{
+				{user: "alice", replied: true},
+				{user: "alice", replied: true},
+				{user: "alice", replied: false},
+				{user: "bob", replied: true},
+				{advance: 5 * time.Second, user: "alice", replied: false},
+				{advance: 5 * time.Second, user: "alice", replied: true},
+				// public messages are not counted
+				{user: "alice", public: true, replied: true},
+			},
+			want: mmbot.Stats{LimitedUser: 2},
+		},
+		{
+			name:   "channel limit",
+			config: mmbot.Config{ChannelLimit: mmbot.TriggerLimit{Burst: 2, Interval: time.Minute}},
+			steps: []limitStep{
+				{user: "alice", channel: "dev", replied: true},
+				{user: "bob", channel: "dev", replied: true},
+				{user: "carol", channel: "dev", replied: false},
+				{user: "carol", channel: "random", replied: true},
+				{advance: time.Minute, user: "carol", channel: "dev", replied: true},
+			},
+			want: mmbot.Stats{LimitedChannel: 1},
+		},
+		{
+			name:   "handler limit",
+			config: mmbot.Config{HandlerLimit: mmbot.TriggerLimit{Burst: 1, Interval: time.Minute}},
+			steps: []limitStep{
+				{user: "alice", public: true, replied: true},
+				{user: "bob", public: true, replied: false},
+				{user: "carol", channel: "random", replied: false},
+				{advance: time.Minute, user: "bob", public: true, replied: true},
+			},
+			want: mmbot.Stats{LimitedHandler: 2},
+		},
+	}
+
+	for _, tt := range tests {
+		h := mmbottest.New(mmbot.PatternHandler{
+			MessageType: message.PublicMessage | message.MentionMessage,
+			Pattern:     regexp.MustCompile(`ping\z`),
+			Action: func(msg *message.InMessage) error {
+				return msg.Reply("pong")
+			},
+		})
+		h.Robot.Config.UserLimit = tt.config.UserLimit
+		h.Robot.Config.ChannelLimit = tt.config.ChannelLimit
+		h.Robot.Config.HandlerLimit = tt.config.HandlerLimit
+
+		for i, step := range tt.steps {
+			h.Clock.Add(step.advance)
+			h.User = step.user
+			h.Channel = step.channel
+			if h.Channel == "" {
+				h.Channel = mmbottest.DefaultChannel
+			}
+			h.Reset()
+			if step.public {
+				h.Public("ping")
+			} else {
+				h.Mention("ping")
+			}
+			if replied := len(h.Sent()) > 0; replied != step.replied {
+				t.Errorf("%s: step %d: replied = %v, want %v", tt.name, i, replied, step.replied)
+			}
+		}
+
+		stats := h.Robot.Stats()
+		got := mmbot.Stats{
+			LimitedUser:    stats.LimitedUser,
+			LimitedChannel: stats.LimitedChannel,
+			LimitedHandler: stats.LimitedHandler,
+		}
+		if got != tt.want {
+			t.Errorf("%s: limit counters = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLimitNotify(t *testing.T) {
+	h := mmbottest.New(mmbot.PatternHandler{
+		MessageType: message.MentionMessage,
+		Pattern:     regexp.MustCompile(`ping\z`),
+		Action: func(msg *message.InMessage) error {
+			return msg.Reply("pong")
+		},
+	})
+	h.Robot.Config.UserLimit = mmbot.TriggerLimit{Burst: 1, Interval: 10 * time.Second}
+	h.Robot.Config.LimitPolicy = mmbot.LimitNotify
+	h.Robot.Config.CooldownMessage = "wait"
+
+	h.Mention("ping")
+	h.Mention("ping")
+	h.Mention("ping")
+	h.Clock.Add(10 * time.Second)
+	h.Mention("ping")
+
+	want := []string{"@user pong", "@user wait", "@user pong"}
+	sent := h.Sent()
+	if len(sent) != len(want) {
+		t.Fatalf("sent %d messages, want %d", len(sent), len(want))
+	}
+	for i, msg := range sent {
+		if msg.Text != want[i] {
+			t.Errorf("sent[%d] = %q, want %q", i, msg.Text, want[i])
+		}
+	}
+	if got := h.Robot.Stats().LimitedUser; got != 2 {
+		t.Errorf("LimitedUser = %d, want 2", got)
+	}
+}
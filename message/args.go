@@ -0,0 +1,43 @@
+package message
+
+import "time"
+
+// Args holds parsed arguments and flags of a command.
+// Values are string, int, float64, bool or time.Duration according to the declared type.
+type Args map[string]interface{}
+
+// Has returns true if the argument or flag is given or has a default value.
+func (a Args) Has(name string) bool {
+	_, ok := a[name]
+	return ok
+}
+
+// String returns the string value of the argument.
+func (a Args) String(name string) string {
+	v, _ := a[name].(string)
+	return v
+}
+
+// Int returns the int value of the argument.
+func (a Args) Int(name string) int {
+	v, _ := a[name].(int)
+	return v
+}
+
+// Float returns the float64 value of the argument.
+func (a Args) Float(name string) float64 {
+	v, _ := a[name].(float64)
+	return v
+}
+
+// Bool returns the bool value of the argument.
+func (a Args) Bool(name string) bool {
+	v, _ := a[name].(bool)
+	return v
+}
+
+// Duration returns the time.Duration value of the argument.
+func (a Args) Duration(name string) time.Duration {
+	v, _ := a[name].(time.Duration)
+	return v
+}
@@ -0,0 +1,60 @@
+package message
+
+// Attachment represents a message attachment (a.k.a. rich message card).
+// See https://docs.mattermost.com/developer/message-attachments.html
+type Attachment struct {
+	Fallback   string             `json:"fallback,omitempty"`    // plain-text summary for notifications
+	Color      string             `json:"color,omitempty"`       // left border color (e.g. "#FF8000")
+	Pretext    string             `json:"pretext,omitempty"`     // text shown above the attachment
+	AuthorName string             `json:"author_name,omitempty"` // author name
+	AuthorLink string             `json:"author_link,omitempty"` // link of the author name
+	AuthorIcon string             `json:"author_icon,omitempty"` // icon URL of the author
+	Title      string             `json:"title,omitempty"`       // title
+	TitleLink  string             `json:"title_link,omitempty"`  // link of the title
+	Text       string             `json:"text,omitempty"`        // main text (markdown)
+	Fields     []*AttachmentField `json:"fields,omitempty"`      // table of fields
+	ImageURL   string             `json:"image_url,omitempty"`   // image shown below the text
+	ThumbURL   string             `json:"thumb_url,omitempty"`   // thumbnail shown on the right
+	Footer     string             `json:"footer,omitempty"`      // footer text
+	FooterIcon string             `json:"footer_icon,omitempty"` // icon URL of the footer
+	Actions    []*Action          `json:"actions,omitempty"`     // buttons and menus
+}
+
+// AttachmentField is a field of an attachment.
+type AttachmentField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"` // display side by side with other short fields
+}
+
+// Action types.
+const (
+	ButtonAction = "button"
+	SelectAction = "select"
+)
+
+// Action is an interactive button or select menu of an attachment.
+// See https://docs.mattermost.com/developer/interactive-messages.html
+type Action struct {
+	ID            string             `json:"id,omitempty"`
+	Name          string             `json:"name"`                     // label of the button or menu
+	Type          string             `json:"type,omitempty"`           // ButtonAction (default) or SelectAction
+	Style         string             `json:"style,omitempty"`          // button style (e.g. "primary", "danger")
+	DataSource    string             `json:"data_source,omitempty"`    // "users" or "channels" for dynamic menus
+	Options       []*ActionOption    `json:"options,omitempty"`        // options of the menu
+	DefaultOption string             `json:"default_option,omitempty"` // value of the initially selected option
+	Integration   *ActionIntegration `json:"integration,omitempty"`    // callback of the action
+}
+
+// ActionOption is an option of a select menu.
+type ActionOption struct {
+	Text  string `json:"text"`
+	Value string `json:"value"`
+}
+
+// ActionIntegration is the callback of an action.
+// Mattermost posts Context to URL when the action is clicked or selected.
+type ActionIntegration struct {
+	URL     string                 `json:"url"`
+	Context map[string]interface{} `json:"context,omitempty"`
+}
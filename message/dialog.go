@@ -0,0 +1,45 @@
+package message
+
+// Dialog element types.
+const (
+	TextElement     = "text"
+	TextareaElement = "textarea"
+	SelectElement   = "select"
+	BoolElement     = "bool"
+	RadioElement    = "radio"
+)
+
+// Dialog is an interactive dialog (modal form).
+// See https://docs.mattermost.com/developer/interactive-dialogs.html
+type Dialog struct {
+	CallbackID       string           `json:"callback_id,omitempty"`
+	Title            string           `json:"title"`
+	IntroductionText string           `json:"introduction_text,omitempty"` // text shown above the elements (markdown)
+	IconURL          string           `json:"icon_url,omitempty"`
+	Elements         []*DialogElement `json:"elements,omitempty"`
+	SubmitLabel      string           `json:"submit_label,omitempty"`     // label of the submit button (default: "Submit")
+	NotifyOnCancel   bool             `json:"notify_on_cancel,omitempty"` // submit with Cancelled when the dialog is canceled
+	State            string           `json:"state,omitempty"`            // string passed through to the submission
+}
+
+// DialogElement is an input element of a dialog.
+type DialogElement struct {
+	DisplayName string          `json:"display_name"`
+	Name        string          `json:"name"`              // key of the submitted value
+	Type        string          `json:"type"`              // TextElement, TextareaElement, SelectElement, BoolElement or RadioElement
+	SubType     string          `json:"subtype,omitempty"` // text input type (e.g. "email", "number", "password")
+	Default     string          `json:"default,omitempty"`
+	Placeholder string          `json:"placeholder,omitempty"`
+	HelpText    string          `json:"help_text,omitempty"`
+	Optional    bool            `json:"optional,omitempty"`
+	MinLength   int             `json:"min_length,omitempty"`
+	MaxLength   int             `json:"max_length,omitempty"`
+	DataSource  string          `json:"data_source,omitempty"` // "users" or "channels" for dynamic selects
+	Options     []*DialogOption `json:"options,omitempty"`
+}
+
+// DialogOption is an option of a select or radio element.
+type DialogOption struct {
+	Text  string `json:"text"`
+	Value string `json:"value"`
+}
@@ -29,19 +29,25 @@ const (
 	DirectMessage
 
 	// CommandMessage means the message is command like message such as starting with "/".
-	// CommandMessage
+	CommandMessage
 )
 
 // InMessage represents an incoming message.
 type InMessage struct {
 	Sender      Sender
 	Matches     []string // captured strings in the pattern
+	Args        Args     // parsed arguments of the command
 	Type        Type
 	ChannelID   string
 	ChannelName string
 	UserID      string
 	UserName    string
-	Text        string
+	PostID      string      // ID of the post
+	RootID      string      // ID of the thread root post (empty if not in a thread)
+	Command     string      // slash command such as "/deploy" (CommandMessage only)
+	TriggerID   string      // trigger ID for opening a dialog (CommandMessage only)
+	Text        string      // full text including the command for CommandMessage
+	Adapter     string      // name of the adapter that received the message
 	RawMessage  interface{} // adapter's raw message data
 }
 
@@ -51,9 +57,15 @@ type OutMessage struct {
 	ChannelName string
 	UserName    string
 	IconURL     string
+	RootID      string // ID of the thread root post to reply to
 	Text        string
-	InReplyTo   *InMessage // reply target message
-	TriggeredBy *InMessage // trigger source message
+	Attachments []*Attachment
+	Props       map[string]interface{} // additional properties of the post
+	Type        string                 // post type (must begin with "custom_" if set)
+	Ephemeral   bool                   // visible only to the user (slash command responses only)
+	InReplyTo   *InMessage             // reply target message
+	TriggeredBy *InMessage             // trigger source message
+	Adapter     string                 // name of the adapter to send through (default: the adapter of InReplyTo/TriggeredBy)
 }
 
 var mentionNameRegexp = regexp.MustCompile(`\A@([0-9a-zA-Z_]+)`)
@@ -77,20 +89,48 @@ func (in *InMessage) MentionlessText() string {
 	return in.Text
 }
 
-// Reply sends a reply message to the sender.
+// CommandlessText returns the text which is trimmed the slash command part.
+func (in *InMessage) CommandlessText() string {
+	if in.Command == "" || !strings.HasPrefix(in.Text, in.Command) {
+		return in.Text
+	}
+
+	return strings.TrimSpace(in.Text[len(in.Command):])
+}
+
+// ThreadID returns the ID of the thread root post which the message belongs to.
+// It returns the message's own post ID if the message is not in a thread.
+func (in *InMessage) ThreadID() string {
+	if in.RootID != "" {
+		return in.RootID
+	}
+	return in.PostID
+}
+
+// Reply sends a reply message to the sender in the thread of the message.
 func (in *InMessage) Reply(text string) error {
+	msg := in.newReply(text)
+	msg.RootID = in.ThreadID()
+
+	return in.Sender.Send(msg)
+}
+
+// ReplyInChannel sends a reply message to the sender in the channel, not in the thread.
+func (in *InMessage) ReplyInChannel(text string) error {
+	return in.Sender.Send(in.newReply(text))
+}
+
+func (in *InMessage) newReply(text string) *OutMessage {
 	targetUser := "@" + in.UserName
 	if !strings.HasPrefix(text, targetUser) {
 		text = targetUser + " " + text
 	}
 
-	msg := &OutMessage{
+	return &OutMessage{
 		ChannelID:   in.ChannelID,
 		ChannelName: in.ChannelName,
 		Text:        text,
 		InReplyTo:   in,
 		TriggeredBy: in,
 	}
-
-	return in.Sender.Send(msg)
 }
@@ -0,0 +1,143 @@
+package mmbot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"runtime"
+	"time"
+
+	"github.com/yukithm/mmbot/message"
+)
+
+var (
+	// ErrAccessDenied is returned by AccessControlMiddleware when the message is not allowed.
+	ErrAccessDenied = errors.New("mmbot: access denied")
+
+	// ErrRateLimited is returned by RateLimitMiddleware when the sender exceeds the limit.
+	ErrRateLimited = errors.New("mmbot: rate limit exceeded")
+)
+
+// HandlerFunc is a function that processes a message, typically ContextHandler.HandleContext.
+type HandlerFunc func(context.Context, *message.InMessage) error
+
+// Middleware wraps HandlerFunc to add processing around handlers.
+type Middleware func(next HandlerFunc) HandlerFunc
+
+// Use adds middlewares that run around every handler call.
+// Middlewares are called in the order they are added; the first one is the outermost.
+// The robot always runs RecoveryMiddleware and logs errors of handlers outside of them.
+func (r *Robot) Use(middlewares ...Middleware) {
+	r.middlewares = append(r.middlewares, middlewares...)
+}
+
+func (r *Robot) applyMiddlewares(h HandlerFunc) HandlerFunc {
+	for i := len(r.middlewares) - 1; i >= 0; i-- {
+		h = r.middlewares[i](h)
+	}
+	h = RecoveryMiddleware()(h)
+	return errorLoggingMiddleware(r.Logger)(h)
+}
+
+// errorLoggingMiddleware logs errors of handlers except ErrConsumed.
+func errorLoggingMiddleware(logger *log.Logger) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, msg *message.InMessage) error {
+			err := next(ctx, msg)
+			if err != nil && err != ErrConsumed {
+				logger.Print(err)
+			}
+			return err
+		}
+	}
+}
+
+// LoggingMiddleware logs incoming messages.
+// Errors of handlers are logged by the robot.
+func LoggingMiddleware(logger *log.Logger) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, msg *message.InMessage) error {
+			logger.Printf("Handle message from %q in %q: %q", msg.UserName, msg.ChannelName, msg.Text)
+			return next(ctx, msg)
+		}
+	}
+}
+
+// TimingMiddleware logs the elapsed time of handlers that take threshold or longer.
+func TimingMiddleware(logger *log.Logger, threshold time.Duration) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, msg *message.InMessage) error {
+			start := time.Now()
+			err := next(ctx, msg)
+			if elapsed := time.Since(start); elapsed >= threshold {
+				logger.Printf("Handler took %s for %q", elapsed, msg.Text)
+			}
+			return err
+		}
+	}
+}
+
+// RecoveryMiddleware recovers from panics in handlers and returns them as errors.
+// The robot runs it around every handler call, so it need not be added by Robot.Use.
+func RecoveryMiddleware() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, msg *message.InMessage) (err error) {
+			defer func() {
+				if e := recover(); e != nil {
+					err = panicError(e)
+				}
+			}()
+			return next(ctx, msg)
+		}
+	}
+}
+
+// panicError returns the error of the recovered panic with the stack trace.
+func panicError(e interface{}) error {
+	const size = 64 << 10
+	buf := make([]byte, size)
+	buf = buf[:runtime.Stack(buf, false)]
+	return fmt.Errorf("mmbot: panic handler: %v\n%s", e, buf)
+}
+
+// AccessControlMiddleware calls handlers only if allow returns true.
+// Otherwise it returns ErrAccessDenied.
+func AccessControlMiddleware(allow func(*message.InMessage) bool) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, msg *message.InMessage) error {
+			if !allow(msg) {
+				return ErrAccessDenied
+			}
+			return next(ctx, msg)
+		}
+	}
+}
+
+// AllowUsers returns AccessControlMiddleware that allows only the users.
+func AllowUsers(userNames ...string) Middleware {
+	users := make(map[string]bool, len(userNames))
+	for _, name := range userNames {
+		users[name] = true
+	}
+	return AccessControlMiddleware(func(msg *message.InMessage) bool {
+		return users[msg.UserName]
+	})
+}
+
+// RateLimitMiddleware limits handler calls per user.
+// Each user can trigger handlers burst times, then once every interval.
+// Otherwise it returns ErrRateLimited.
+// It counts handler calls, not messages: a message that several handlers
+// can handle takes a token for each of them. Config.UserLimit counts messages.
+func RateLimitMiddleware(burst int, interval time.Duration) Middleware {
+	limiter := newRateLimiter(burst, interval)
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, msg *message.InMessage) error {
+			if !limiter.allow(msg.UserName, time.Now()) {
+				return ErrRateLimited
+			}
+			return next(ctx, msg)
+		}
+	}
+}
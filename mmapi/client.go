@@ -0,0 +1,404 @@
+// Package mmapi implements an adapter that uses Mattermost REST API v4 and WebSocket API.
+package mmapi
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/yukithm/mmbot/adapter"
+	"github.com/yukithm/mmbot/message"
+)
+
+const (
+	apiPath       = "/api/v4"
+	websocketPath = apiPath + "/websocket"
+
+	minReconnectWait = 1 * time.Second
+	maxReconnectWait = 60 * time.Second
+)
+
+// ErrNotLoggedIn is returned when a message is sent before the client logs in to Mattermost.
+var ErrNotLoggedIn = errors.New("mmapi: not logged in")
+
+// APIError represents an error response of Mattermost REST API.
+type APIError struct {
+	StatusCode int    `json:"status_code"`
+	ID         string `json:"id"`
+	Message    string `json:"message"`
+	RequestID  string `json:"request_id"`
+}
+
+func (e APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("Mattermost API error (%d)", e.StatusCode)
+	}
+	return fmt.Sprintf("Mattermost API error (%d): %s", e.StatusCode, e.Message)
+}
+
+// Client is a client for Mattermost REST API and WebSocket API.
+type Client struct {
+	config *adapter.Config
+	logger *log.Logger
+	http   *http.Client
+	dialer *websocket.Dialer
+	in     chan message.InMessage
+	errCh  chan error
+	quit   chan struct{}
+	done   chan struct{}
+
+	stopOnce sync.Once
+
+	mu       sync.Mutex
+	me       *User // nil until logged in
+	team     *Team
+	conn     *websocket.Conn
+	channels map[string]string // channel name -> channel ID
+}
+
+// NewClient returns new Mattermost API client.
+func NewClient(config *adapter.Config, logger *log.Logger) *Client {
+	if logger == nil {
+		logger = log.New(ioutil.Discard, "", 0)
+	}
+	c := &Client{
+		config:   config,
+		logger:   logger,
+		channels: make(map[string]string),
+	}
+
+	tr := &http.Transport{
+		Dial: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).Dial,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+	c.dialer = &websocket.Dialer{
+		HandshakeTimeout: 30 * time.Second,
+	}
+	if config.InsecureSkipVerify {
+		tr.TLSClientConfig = &tls.Config{
+			InsecureSkipVerify: config.InsecureSkipVerify,
+		}
+		c.dialer.TLSClientConfig = tr.TLSClientConfig
+	}
+	c.http = &http.Client{Transport: tr}
+
+	return c
+}
+
+// Start logs in to Mattermost and starts listening to the WebSocket events.
+func (c *Client) Start() (chan message.InMessage, chan error) {
+	c.in = make(chan message.InMessage, 1)
+	c.errCh = make(chan error, 1)
+	c.quit = make(chan struct{})
+	c.done = make(chan struct{})
+	c.stopOnce = sync.Once{}
+
+	go func() {
+		defer close(c.done)
+		if err := c.login(); err != nil {
+			c.errCh <- err
+			return
+		}
+		c.listen()
+	}()
+
+	return c.in, c.errCh
+}
+
+// Stop terminates the communication.
+// It does nothing if the client is not started or already stopped.
+func (c *Client) Stop() {
+	if c.quit == nil {
+		return
+	}
+	c.stopOnce.Do(func() {
+		close(c.quit)
+		c.mu.Lock()
+		if c.conn != nil {
+			c.conn.Close()
+		}
+		c.mu.Unlock()
+		<-c.done
+
+		close(c.in)
+		close(c.errCh)
+	})
+}
+
+// Send posts a message to Mattermost.
+// It returns ErrNotLoggedIn until the client has logged in.
+func (c *Client) Send(msg *message.OutMessage) error {
+	me, team := c.session()
+	if me == nil {
+		return ErrNotLoggedIn
+	}
+
+	post := translateOutMessage(msg)
+	if c.config.OverrideUserName != "" && msg.UserName == "" {
+		post.Props["override_username"] = c.config.OverrideUserName
+	}
+	if c.config.IconURL != "" && msg.IconURL == "" {
+		post.Props["override_icon_url"] = c.config.IconURL
+	}
+	if len(post.Props) == 0 {
+		post.Props = nil
+	}
+
+	if post.ChannelID == "" {
+		id, err := c.channelID(outChannelName(msg), me, team)
+		if err != nil {
+			return err
+		}
+		post.ChannelID = id
+	}
+
+	return c.post("/posts", post, nil)
+}
+
+// IncomingWebHook returns webhook. It will be disabled if nil.
+func (c *Client) IncomingWebHook() *adapter.IncomingWebHook {
+	return nil
+}
+
+// OpenDialog opens the dialog for the trigger ID.
+func (c *Client) OpenDialog(triggerID string, url string, dialog *message.Dialog) error {
+	return c.post("/actions/dialogs/open", &OpenDialogRequest{
+		TriggerID: triggerID,
+		URL:       url,
+		Dialog:    dialog,
+	}, nil)
+}
+
+// Me returns the logged in bot user, or nil if the client has not logged in.
+func (c *Client) Me() *User {
+	me, _ := c.session()
+	return me
+}
+
+// session returns the bot user and the team.
+// The user is nil if the client has not logged in.
+func (c *Client) session() (*User, *Team) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.me, c.team
+}
+
+// login gets the bot user and the team.
+// They are published together when both are known.
+func (c *Client) login() error {
+	var me User
+	if err := c.get("/users/me", &me); err != nil {
+		return err
+	}
+
+	var team *Team
+	if c.config.TeamName != "" {
+		team = &Team{}
+		if err := c.get("/teams/name/"+url.PathEscape(c.config.TeamName), team); err != nil {
+			return err
+		}
+	}
+
+	c.mu.Lock()
+	c.me = &me
+	c.team = team
+	c.mu.Unlock()
+	c.logger.Printf("Logged in to %s as %q", c.config.ServerURL, me.UserName)
+
+	return nil
+}
+
+func (c *Client) listen() {
+	wait := minReconnectWait
+	for {
+		connected, err := c.receive()
+		select {
+		case <-c.quit:
+			return
+		default:
+		}
+
+		if connected {
+			wait = minReconnectWait
+		}
+		c.logger.Printf("WebSocket disconnected: %v (reconnect after %s)", err, wait)
+
+		select {
+		case <-c.quit:
+			return
+		case <-time.After(wait):
+		}
+
+		wait *= 2
+		if wait > maxReconnectWait {
+			wait = maxReconnectWait
+		}
+	}
+}
+
+// receive connects to the WebSocket API and reads events until an error occurs.
+func (c *Client) receive() (bool, error) {
+	me, _ := c.session()
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+c.config.AccessToken)
+	conn, _, err := c.dialer.Dial(c.websocketURL(), header)
+	if err != nil {
+		return false, err
+	}
+
+	c.mu.Lock()
+	select {
+	case <-c.quit:
+		c.mu.Unlock()
+		conn.Close()
+		return true, errors.New("Stopped")
+	default:
+	}
+	c.conn = conn
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.conn = nil
+		c.mu.Unlock()
+		conn.Close()
+	}()
+
+	for {
+		var ev Event
+		if err := conn.ReadJSON(&ev); err != nil {
+			return true, err
+		}
+		if ev.Event != EventPosted {
+			continue
+		}
+
+		posted, err := ev.PostedEvent()
+		if err != nil {
+			c.logger.Printf("Invalid posted event: %v", err)
+			continue
+		}
+		if posted.Post.UserID == me.ID || posted.Post.Type != "" {
+			continue
+		}
+
+		select {
+		case <-c.quit:
+			return true, errors.New("Stopped")
+		case c.in <- *translateInMessage(posted):
+		}
+	}
+}
+
+// channelID returns the ID of the channel name such as "town-square" or "@alice".
+func (c *Client) channelID(name string, me *User, team *Team) (string, error) {
+	if name == "" {
+		return "", errors.New("No channel specified")
+	}
+
+	c.mu.Lock()
+	id, ok := c.channels[name]
+	c.mu.Unlock()
+	if ok {
+		return id, nil
+	}
+
+	var channel Channel
+	if strings.HasPrefix(name, "@") {
+		var user User
+		if err := c.get("/users/username/"+url.PathEscape(name[1:]), &user); err != nil {
+			return "", err
+		}
+		if err := c.post("/channels/direct", []string{me.ID, user.ID}, &channel); err != nil {
+			return "", err
+		}
+	} else {
+		if team == nil {
+			return "", fmt.Errorf("Cannot resolve channel %q without team name", name)
+		}
+		path := fmt.Sprintf("/teams/%s/channels/name/%s", team.ID, url.PathEscape(name))
+		if err := c.get(path, &channel); err != nil {
+			return "", err
+		}
+	}
+
+	c.mu.Lock()
+	c.channels[name] = channel.ID
+	c.mu.Unlock()
+
+	return channel.ID, nil
+}
+
+func (c *Client) get(path string, v interface{}) error {
+	return c.do("GET", path, nil, v)
+}
+
+func (c *Client) post(path string, body interface{}, v interface{}) error {
+	buf, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	return c.do("POST", path, buf, v)
+}
+
+func (c *Client) do(method, path string, body []byte, v interface{}) error {
+	req, err := http.NewRequest(method, c.apiURL(path), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.config.AccessToken)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return newAPIError(res)
+	}
+	if v == nil {
+		io.Copy(ioutil.Discard, res.Body)
+		return nil
+	}
+
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+func (c *Client) apiURL(path string) string {
+	return strings.TrimSuffix(c.config.ServerURL, "/") + apiPath + path
+}
+
+func (c *Client) websocketURL() string {
+	u := strings.TrimSuffix(c.config.ServerURL, "/") + websocketPath
+	if strings.HasPrefix(u, "https://") {
+		return "wss://" + strings.TrimPrefix(u, "https://")
+	}
+	return "ws://" + strings.TrimPrefix(u, "http://")
+}
+
+func newAPIError(res *http.Response) APIError {
+	e := APIError{}
+	json.NewDecoder(res.Body).Decode(&e)
+	e.StatusCode = res.StatusCode
+	return e
+}
@@ -0,0 +1,293 @@
+package mmapi_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/yukithm/mmbot/adapter"
+	"github.com/yukithm/mmbot/message"
+	"github.com/yukithm/mmbot/mmapi"
+	"github.com/yukithm/mmbot/mmapi/mmapitest"
+)
+
+const (
+	testToken   = "token"
+	testTimeout = 5 * time.Second
+)
+
+// startClient starts the client and waits until it receives a message,
+// so that the client has logged in and listens to the WebSocket events.
+// The caller must stop the client.
+func startClient(t *testing.T, s *mmapitest.Server) (*mmapi.Client, chan message.InMessage) {
+	t.Helper()
+
+	c := mmapi.NewClient(&adapter.Config{
+		ServerURL:   s.URL,
+		AccessToken: testToken,
+		TeamName:    "team",
+	}, nil)
+	in, errCh := c.Start()
+	if !s.WaitConnected(testTimeout) {
+		select {
+		case err := <-errCh:
+			c.Stop()
+			t.Fatalf("Start() failed: %v", err)
+		default:
+			c.Stop()
+			t.Fatal("client did not connect")
+		}
+	}
+
+	ping := s.AddChannel("ping", mmapi.ChannelOpen)
+	if _, err := s.Publish(s.AddUser("pinger"), ping, "ping"); err != nil {
+		t.Fatal(err)
+	}
+	receiveMessage(t, in)
+	return c, in
+}
+
+func receiveMessage(t *testing.T, in chan message.InMessage) message.InMessage {
+	t.Helper()
+
+	select {
+	case msg := <-in:
+		return msg
+	case <-time.After(testTimeout):
+		t.Fatal("no message received")
+		return message.InMessage{}
+	}
+}
+
+func TestLogin(t *testing.T) {
+	s := mmapitest.NewServer(testToken)
+	defer s.Close()
+
+	c, _ := startClient(t, s)
+	defer c.Stop()
+	if me := c.Me(); me == nil || me.ID != s.Bot.ID || me.UserName != "mmbot" {
+		t.Errorf("Me() = %+v, want %+v", me, s.Bot)
+	}
+}
+
+func TestLoginUnauthorized(t *testing.T) {
+	s := mmapitest.NewServer(testToken)
+	defer s.Close()
+
+	c := mmapi.NewClient(&adapter.Config{
+		ServerURL:   s.URL,
+		AccessToken: "wrong",
+	}, nil)
+	_, errCh := c.Start()
+	defer c.Stop()
+
+	select {
+	case err := <-errCh:
+		apiErr, ok := err.(mmapi.APIError)
+		if !ok || apiErr.StatusCode != http.StatusUnauthorized {
+			t.Errorf("error = %#v, want APIError with status 401", err)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("no error reported")
+	}
+}
+
+func TestSendBeforeLogin(t *testing.T) {
+	s := mmapitest.NewServer(testToken)
+	defer s.Close()
+
+	c := mmapi.NewClient(&adapter.Config{
+		ServerURL:   s.URL,
+		AccessToken: "wrong",
+	}, nil)
+	if err := c.Send(&message.OutMessage{ChannelName: "@alice", Text: "hello"}); err != mmapi.ErrNotLoggedIn {
+		t.Errorf("Send() before Start() = %v, want %v", err, mmapi.ErrNotLoggedIn)
+	}
+
+	_, errCh := c.Start()
+	select {
+	case <-errCh:
+	case <-time.After(testTimeout):
+		t.Fatal("no error reported")
+	}
+	if err := c.Send(&message.OutMessage{ChannelName: "@alice", Text: "hello"}); err != mmapi.ErrNotLoggedIn {
+		t.Errorf("Send() after failed login = %v, want %v", err, mmapi.ErrNotLoggedIn)
+	}
+	if me := c.Me(); me != nil {
+		t.Errorf("Me() = %+v, want nil", me)
+	}
+
+	c.Stop()
+	c.Stop()
+}
+
+func TestReceive(t *testing.T) {
+	s := mmapitest.NewServer(testToken)
+	defer s.Close()
+
+	alice := s.AddUser("alice")
+	town := s.AddChannel("town-square", mmapi.ChannelOpen)
+	direct := s.AddChannel(alice.ID+"__"+s.Bot.ID, mmapi.ChannelDirect)
+	c, in := startClient(t, s)
+	defer c.Stop()
+
+	tests := []struct {
+		user        *mmapi.User
+		channel     *mmapi.Channel
+		text        string
+		msgType     message.Type
+		channelName string
+	}{
+		{alice, town, "hello", message.PublicMessage, "town-square"},
+		{alice, town, "@mmbot ping", message.MentionMessage, "town-square"},
+		{alice, direct, "hi", message.DirectMessage, "@alice"},
+	}
+	for _, tt := range tests {
+		post, err := s.Publish(tt.user, tt.channel, tt.text)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		msg := receiveMessage(t, in)
+		if msg.Type != tt.msgType {
+			t.Errorf("%q: Type = %v, want %v", tt.text, msg.Type, tt.msgType)
+		}
+		if msg.ChannelID != tt.channel.ID || msg.ChannelName != tt.channelName {
+			t.Errorf("%q: channel = %q (%s), want %q (%s)", tt.text, msg.ChannelName, msg.ChannelID, tt.channelName, tt.channel.ID)
+		}
+		if msg.UserID != alice.ID || msg.UserName != "alice" {
+			t.Errorf("%q: user = %q (%s), want %q (%s)", tt.text, msg.UserName, msg.UserID, "alice", alice.ID)
+		}
+		if msg.PostID != post.ID || msg.Text != tt.text {
+			t.Errorf("%q: post = %q %q, want %q %q", tt.text, msg.PostID, msg.Text, post.ID, tt.text)
+		}
+	}
+}
+
+func TestReceiveIgnoresOwnPosts(t *testing.T) {
+	s := mmapitest.NewServer(testToken)
+	defer s.Close()
+
+	alice := s.AddUser("alice")
+	town := s.AddChannel("town-square", mmapi.ChannelOpen)
+	c, in := startClient(t, s)
+	defer c.Stop()
+
+	if _, err := s.Publish(s.Bot, town, "by bot"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Publish(alice, town, "by alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	if msg := receiveMessage(t, in); msg.Text != "by alice" {
+		t.Errorf("Text = %q, want %q", msg.Text, "by alice")
+	}
+}
+
+func TestSend(t *testing.T) {
+	s := mmapitest.NewServer(testToken)
+	defer s.Close()
+
+	town := s.AddChannel("town-square", mmapi.ChannelOpen)
+	c, _ := startClient(t, s)
+	defer c.Stop()
+
+	if err := c.Send(&message.OutMessage{ChannelID: town.ID, Text: "by ID"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Send(&message.OutMessage{ChannelName: "town-square", Text: "by name", RootID: "root"}); err != nil {
+		t.Fatal(err)
+	}
+	in := &message.InMessage{ChannelID: town.ID, ChannelName: "town-square"}
+	if err := c.Send(&message.OutMessage{InReplyTo: in, Text: "reply"}); err != nil {
+		t.Fatal(err)
+	}
+
+	posts := s.Posts()
+	if len(posts) != 3 {
+		t.Fatalf("%d posts, want 3", len(posts))
+	}
+	for i, text := range []string{"by ID", "by name", "reply"} {
+		if posts[i].Message != text || posts[i].ChannelID != town.ID || posts[i].UserID != s.Bot.ID {
+			t.Errorf("posts[%d] = %+v, want %q in %s by the bot", i, posts[i], text, town.ID)
+		}
+	}
+	if posts[1].RootID != "root" {
+		t.Errorf("RootID = %q, want %q", posts[1].RootID, "root")
+	}
+}
+
+func TestSendUnknownChannel(t *testing.T) {
+	s := mmapitest.NewServer(testToken)
+	defer s.Close()
+
+	c, _ := startClient(t, s)
+	defer c.Stop()
+
+	err := c.Send(&message.OutMessage{ChannelName: "unknown", Text: "hello"})
+	if apiErr, ok := err.(mmapi.APIError); !ok || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("error = %#v, want APIError with status 404", err)
+	}
+	if err := c.Send(&message.OutMessage{Text: "hello"}); err == nil {
+		t.Error("Send() without channel succeeded")
+	}
+}
+
+func TestSendDirect(t *testing.T) {
+	s := mmapitest.NewServer(testToken)
+	defer s.Close()
+
+	s.AddUser("alice")
+	c, _ := startClient(t, s)
+	defer c.Stop()
+
+	for _, text := range []string{"first", "second"} {
+		if err := c.Send(&message.OutMessage{ChannelName: "@alice", Text: text}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	posts := s.Posts()
+	if len(posts) != 2 {
+		t.Fatalf("%d posts, want 2", len(posts))
+	}
+	if posts[0].ChannelID == "" || posts[0].ChannelID != posts[1].ChannelID {
+		t.Errorf("channels = %q, %q, want the same direct channel", posts[0].ChannelID, posts[1].ChannelID)
+	}
+}
+
+func TestOpenDialog(t *testing.T) {
+	s := mmapitest.NewServer(testToken)
+	defer s.Close()
+
+	c, _ := startClient(t, s)
+	defer c.Stop()
+
+	dialog := &message.Dialog{
+		CallbackID: "deploy",
+		Title:      "Deploy",
+		Elements: []*message.DialogElement{
+			{DisplayName: "Branch", Name: "branch", Type: message.TextElement},
+		},
+		State: "state",
+	}
+	if err := c.OpenDialog("trigger", "http://bot/dialogs", dialog); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.OpenDialog("", "http://bot/dialogs", dialog); err == nil {
+		t.Error("OpenDialog() without trigger ID succeeded")
+	}
+
+	dialogs := s.Dialogs()
+	if len(dialogs) != 1 {
+		t.Fatalf("%d dialogs, want 1", len(dialogs))
+	}
+	got := dialogs[0]
+	if got.TriggerID != "trigger" || got.URL != "http://bot/dialogs" {
+		t.Errorf("request = %q %q, want %q %q", got.TriggerID, got.URL, "trigger", "http://bot/dialogs")
+	}
+	if got.Dialog == nil || got.Dialog.CallbackID != "deploy" || len(got.Dialog.Elements) != 1 || got.Dialog.State != "state" {
+		t.Errorf("dialog = %+v, want %+v", got.Dialog, dialog)
+	}
+}
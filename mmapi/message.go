@@ -0,0 +1,128 @@
+package mmapi
+
+import (
+	"encoding/json"
+
+	"github.com/yukithm/mmbot/message"
+)
+
+// User represents a user of Mattermost.
+type User struct {
+	ID       string `json:"id"`
+	UserName string `json:"username"`
+}
+
+// Team represents a team of Mattermost.
+type Team struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// Channel represents a channel of Mattermost.
+type Channel struct {
+	ID     string `json:"id"`
+	TeamID string `json:"team_id"`
+	Type   string `json:"type"`
+	Name   string `json:"name"`
+}
+
+// Post represents a post of Mattermost.
+type Post struct {
+	ID        string                 `json:"id,omitempty"`
+	CreateAt  int64                  `json:"create_at,omitempty"`
+	UserID    string                 `json:"user_id,omitempty"`
+	ChannelID string                 `json:"channel_id"`
+	RootID    string                 `json:"root_id,omitempty"`
+	Message   string                 `json:"message"`
+	Type      string                 `json:"type,omitempty"`
+	Props     map[string]interface{} `json:"props,omitempty"`
+}
+
+// OpenDialogRequest represents a request to open an interactive dialog.
+// (send to Mattermost)
+type OpenDialogRequest struct {
+	TriggerID string          `json:"trigger_id"`
+	URL       string          `json:"url"`
+	Dialog    *message.Dialog `json:"dialog"`
+}
+
+// Event represents an event from Mattermost WebSocket API.
+type Event struct {
+	Event     string            `json:"event"`
+	Data      map[string]string `json:"data"`
+	Broadcast EventBroadcast    `json:"broadcast"`
+	Seq       int64             `json:"seq"`
+}
+
+// EventBroadcast represents the broadcast target of an event.
+type EventBroadcast struct {
+	UserID    string `json:"user_id"`
+	ChannelID string `json:"channel_id"`
+	TeamID    string `json:"team_id"`
+}
+
+// PostedEvent represents a "posted" event.
+// (received from Mattermost)
+type PostedEvent struct {
+	ChannelName        string
+	ChannelDisplayName string
+	ChannelType        string
+	SenderName         string
+	TeamID             string
+	Post               *Post
+}
+
+// Event names and channel types of Mattermost.
+const (
+	EventPosted = "posted"
+
+	ChannelOpen    = "O"
+	ChannelPrivate = "P"
+	ChannelDirect  = "D"
+	ChannelGroup   = "G"
+)
+
+// UnmarshalJSON implements json.Unmarshaler interface.
+// Event data values other than strings are kept as raw JSON text.
+func (e *Event) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Event     string                     `json:"event"`
+		Data      map[string]json.RawMessage `json:"data"`
+		Broadcast EventBroadcast             `json:"broadcast"`
+		Seq       int64                      `json:"seq"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	e.Event = raw.Event
+	e.Broadcast = raw.Broadcast
+	e.Seq = raw.Seq
+	e.Data = make(map[string]string, len(raw.Data))
+	for key, value := range raw.Data {
+		var s string
+		if err := json.Unmarshal(value, &s); err != nil {
+			s = string(value)
+		}
+		e.Data[key] = s
+	}
+
+	return nil
+}
+
+// PostedEvent decodes the event data as a "posted" event.
+func (e *Event) PostedEvent() (*PostedEvent, error) {
+	var post Post
+	if err := json.Unmarshal([]byte(e.Data["post"]), &post); err != nil {
+		return nil, err
+	}
+
+	return &PostedEvent{
+		ChannelName:        e.Data["channel_name"],
+		ChannelDisplayName: e.Data["channel_display_name"],
+		ChannelType:        e.Data["channel_type"],
+		SenderName:         e.Data["sender_name"],
+		TeamID:             e.Data["team_id"],
+		Post:               &post,
+	}, nil
+}
@@ -0,0 +1,335 @@
+// Package mmapitest provides a fake Mattermost server for testing the mmapi adapter.
+package mmapitest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/yukithm/mmbot/mmapi"
+)
+
+// Server is a fake Mattermost server that serves a subset of REST API v4 and WebSocket API.
+type Server struct {
+	*httptest.Server
+	Token string
+	Bot   *mmapi.User
+	Team  *mmapi.Team
+
+	mu       sync.Mutex
+	seq      int
+	users    map[string]*mmapi.User    // username -> user
+	channels map[string]*mmapi.Channel // channel ID -> channel
+	posts    []*mmapi.Post
+	dialogs  []*mmapi.OpenDialogRequest
+	conns    map[*websocket.Conn]bool
+	upgrader websocket.Upgrader
+}
+
+// NewServer starts and returns new fake server.
+// The bot account "mmbot" and the team "team" are created.
+// Requests must have the access token.
+func NewServer(token string) *Server {
+	s := &Server{
+		Token:    token,
+		users:    make(map[string]*mmapi.User),
+		channels: make(map[string]*mmapi.Channel),
+		conns:    make(map[*websocket.Conn]bool),
+	}
+	s.Bot = s.AddUser("mmbot")
+	s.Team = &mmapi.Team{ID: s.newID(), Name: "team"}
+
+	router := mux.NewRouter()
+	api := router.PathPrefix("/api/v4").Subrouter()
+	api.HandleFunc("/users/me", s.handleMe).Methods("GET")
+	api.HandleFunc("/users/username/{username}", s.handleUserByName).Methods("GET")
+	api.HandleFunc("/teams/name/{name}", s.handleTeamByName).Methods("GET")
+	api.HandleFunc("/teams/{team_id}/channels/name/{name}", s.handleChannelByName).Methods("GET")
+	api.HandleFunc("/channels/direct", s.handleDirectChannel).Methods("POST")
+	api.HandleFunc("/posts", s.handleCreatePost).Methods("POST")
+	api.HandleFunc("/actions/dialogs/open", s.handleOpenDialog).Methods("POST")
+	api.HandleFunc("/websocket", s.handleWebSocket)
+
+	s.Server = httptest.NewServer(s.authorize(router))
+	return s
+}
+
+// Close shuts down the server.
+func (s *Server) Close() {
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.Server.Close()
+}
+
+// AddUser creates new user.
+func (s *Server) AddUser(name string) *mmapi.User {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user := &mmapi.User{ID: s.newID(), UserName: name}
+	s.users[name] = user
+	return user
+}
+
+// AddChannel creates new channel in the team.
+func (s *Server) AddChannel(name string, channelType string) *mmapi.Channel {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	channel := &mmapi.Channel{ID: s.newID(), TeamID: s.Team.ID, Type: channelType, Name: name}
+	s.channels[channel.ID] = channel
+	return channel
+}
+
+// Posts returns the posts that were created via REST API.
+func (s *Server) Posts() []*mmapi.Post {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	posts := make([]*mmapi.Post, len(s.posts))
+	copy(posts, s.posts)
+	return posts
+}
+
+// Dialogs returns the requests to open dialogs that were received via REST API.
+func (s *Server) Dialogs() []*mmapi.OpenDialogRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dialogs := make([]*mmapi.OpenDialogRequest, len(s.dialogs))
+	copy(dialogs, s.dialogs)
+	return dialogs
+}
+
+// WaitPosts waits until n posts are created or timeout expires.
+func (s *Server) WaitPosts(n int, timeout time.Duration) []*mmapi.Post {
+	deadline := time.Now().Add(timeout)
+	for {
+		posts := s.Posts()
+		if len(posts) >= n || time.Now().After(deadline) {
+			return posts
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// WaitConnected waits until a WebSocket client connects or timeout expires.
+func (s *Server) WaitConnected(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		s.mu.Lock()
+		n := len(s.conns)
+		s.mu.Unlock()
+		if n > 0 {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Publish posts a message by the user and broadcasts "posted" event to connected clients.
+func (s *Server) Publish(user *mmapi.User, channel *mmapi.Channel, text string) (*mmapi.Post, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	post := &mmapi.Post{
+		ID:        s.newID(),
+		CreateAt:  time.Now().UnixNano() / int64(time.Millisecond),
+		UserID:    user.ID,
+		ChannelID: channel.ID,
+		Message:   text,
+	}
+	buf, err := json.Marshal(post)
+	if err != nil {
+		return nil, err
+	}
+
+	s.seq++
+	ev := map[string]interface{}{
+		"event": mmapi.EventPosted,
+		"data": map[string]string{
+			"channel_display_name": channel.Name,
+			"channel_name":         channel.Name,
+			"channel_type":         channel.Type,
+			"post":                 string(buf),
+			"sender_name":          "@" + user.UserName,
+			"team_id":              channel.TeamID,
+		},
+		"broadcast": map[string]string{
+			"channel_id": channel.ID,
+		},
+		"seq": s.seq,
+	}
+	for conn := range s.conns {
+		if err := conn.WriteJSON(ev); err != nil {
+			return nil, err
+		}
+	}
+
+	return post, nil
+}
+
+func (s *Server) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+s.Token {
+			writeError(w, http.StatusUnauthorized, "Invalid or expired session")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) handleMe(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.Bot)
+}
+
+func (s *Server) handleUserByName(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	user, ok := s.users[mux.Vars(r)["username"]]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, user)
+}
+
+func (s *Server) handleTeamByName(w http.ResponseWriter, r *http.Request) {
+	if mux.Vars(r)["name"] != s.Team.Name {
+		writeError(w, http.StatusNotFound, "Team not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.Team)
+}
+
+func (s *Server) handleChannelByName(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, channel := range s.channels {
+		if channel.TeamID == vars["team_id"] && channel.Name == vars["name"] {
+			writeJSON(w, http.StatusOK, channel)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "Channel not found")
+}
+
+func (s *Server) handleDirectChannel(w http.ResponseWriter, r *http.Request) {
+	var ids []string
+	if err := json.NewDecoder(r.Body).Decode(&ids); err != nil || len(ids) != 2 {
+		writeError(w, http.StatusBadRequest, "Invalid user IDs")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name := ids[0] + "__" + ids[1]
+	if ids[0] > ids[1] {
+		name = ids[1] + "__" + ids[0]
+	}
+	for _, channel := range s.channels {
+		if channel.Name == name {
+			writeJSON(w, http.StatusCreated, channel)
+			return
+		}
+	}
+	channel := &mmapi.Channel{ID: s.newID(), Type: mmapi.ChannelDirect, Name: name}
+	s.channels[channel.ID] = channel
+	writeJSON(w, http.StatusCreated, channel)
+}
+
+func (s *Server) handleCreatePost(w http.ResponseWriter, r *http.Request) {
+	var post mmapi.Post
+	if err := json.NewDecoder(r.Body).Decode(&post); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.channels[post.ChannelID]; !ok {
+		writeError(w, http.StatusNotFound, "Channel not found")
+		return
+	}
+	post.ID = s.newID()
+	post.UserID = s.Bot.ID
+	post.CreateAt = time.Now().UnixNano() / int64(time.Millisecond)
+	s.posts = append(s.posts, &post)
+	writeJSON(w, http.StatusCreated, &post)
+}
+
+func (s *Server) handleOpenDialog(w http.ResponseWriter, r *http.Request) {
+	var req mmapi.OpenDialogRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.TriggerID == "" || req.URL == "" || req.Dialog == nil {
+		writeError(w, http.StatusBadRequest, "Invalid dialog request")
+		return
+	}
+
+	s.mu.Lock()
+	s.dialogs = append(s.dialogs, &req)
+	s.mu.Unlock()
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.conns[conn] = true
+	s.mu.Unlock()
+
+	// discard client messages until the connection is closed
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			break
+		}
+	}
+
+	s.mu.Lock()
+	delete(s.conns, conn)
+	s.mu.Unlock()
+	conn.Close()
+}
+
+// newID returns new unique ID. s.mu must be locked by the caller.
+func (s *Server) newID() string {
+	s.seq++
+	return fmt.Sprintf("%026d", s.seq)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]interface{}{
+		"id":          "api." + strings.ToLower(http.StatusText(status)),
+		"message":     msg,
+		"status_code": status,
+	})
+}
@@ -0,0 +1,80 @@
+package mmapi
+
+import (
+	"strings"
+
+	"github.com/yukithm/mmbot/message"
+)
+
+func translateInMessage(ev *PostedEvent) *message.InMessage {
+	userName := strings.TrimPrefix(ev.SenderName, "@")
+	channelName := ev.ChannelName
+	if ev.ChannelType == ChannelDirect {
+		channelName = "@" + userName
+	}
+
+	return &message.InMessage{
+		Type:        messageType(ev),
+		ChannelID:   ev.Post.ChannelID,
+		ChannelName: channelName,
+		UserID:      ev.Post.UserID,
+		UserName:    userName,
+		PostID:      ev.Post.ID,
+		RootID:      ev.Post.RootID,
+		Text:        ev.Post.Message,
+		RawMessage:  ev,
+	}
+}
+
+func translateOutMessage(msg *message.OutMessage) *Post {
+	var channelID string
+	if msg.InReplyTo != nil {
+		channelID = msg.InReplyTo.ChannelID
+	} else if msg.TriggeredBy != nil {
+		channelID = msg.TriggeredBy.ChannelID
+	} else {
+		channelID = msg.ChannelID
+	}
+
+	props := make(map[string]interface{}, len(msg.Props))
+	for key, value := range msg.Props {
+		props[key] = value
+	}
+	if len(msg.Attachments) > 0 {
+		props["attachments"] = msg.Attachments
+	}
+	if msg.UserName != "" {
+		props["override_username"] = msg.UserName
+	}
+	if msg.IconURL != "" {
+		props["override_icon_url"] = msg.IconURL
+	}
+
+	return &Post{
+		ChannelID: channelID,
+		RootID:    msg.RootID,
+		Message:   msg.Text,
+		Type:      msg.Type,
+		Props:     props,
+	}
+}
+
+func outChannelName(msg *message.OutMessage) string {
+	if msg.InReplyTo != nil {
+		return msg.InReplyTo.ChannelName
+	} else if msg.TriggeredBy != nil {
+		return msg.TriggeredBy.ChannelName
+	}
+	return msg.ChannelName
+}
+
+func messageType(ev *PostedEvent) message.Type {
+	if ev.ChannelType == ChannelDirect {
+		return message.DirectMessage
+	}
+	if strings.HasPrefix(ev.Post.Message, "@") {
+		return message.MentionMessage
+	}
+
+	return message.PublicMessage
+}
@@ -0,0 +1,96 @@
+// Package mmbottest provides utilities for testing mmbot handlers and jobs.
+package mmbottest
+
+import (
+	"sync"
+
+	"github.com/yukithm/mmbot/adapter"
+	"github.com/yukithm/mmbot/message"
+)
+
+// Adapter is an adapter that records sent messages instead of sending them.
+type Adapter struct {
+	mu   sync.Mutex
+	sent []*message.OutMessage
+
+	recvMu   sync.Mutex // separated from mu so that handlers can send while Receive blocks
+	receiver chan message.InMessage
+	errCh    chan error
+}
+
+var _ adapter.Adapter = (*Adapter)(nil)
+
+// NewAdapter returns new recording adapter.
+func NewAdapter() *Adapter {
+	return &Adapter{}
+}
+
+// Start starts the adapter.
+// Messages passed to Receive are delivered through the returned channel.
+func (a *Adapter) Start() (chan message.InMessage, chan error) {
+	a.recvMu.Lock()
+	defer a.recvMu.Unlock()
+
+	a.receiver = make(chan message.InMessage)
+	a.errCh = make(chan error, 1)
+	return a.receiver, a.errCh
+}
+
+// Stop stops the adapter and closes the channels returned by Start.
+func (a *Adapter) Stop() {
+	a.recvMu.Lock()
+	defer a.recvMu.Unlock()
+
+	if a.receiver != nil {
+		close(a.receiver)
+		close(a.errCh)
+		a.receiver = nil
+		a.errCh = nil
+	}
+}
+
+// Send records the message.
+func (a *Adapter) Send(msg *message.OutMessage) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.sent = append(a.sent, msg)
+	return nil
+}
+
+// IncomingWebHook returns nil.
+func (a *Adapter) IncomingWebHook() *adapter.IncomingWebHook {
+	return nil
+}
+
+// Receive delivers the message to the started robot.
+// It blocks until the robot receives the message.
+// It returns false without blocking if the adapter is not started.
+func (a *Adapter) Receive(msg *message.InMessage) bool {
+	a.recvMu.Lock()
+	defer a.recvMu.Unlock()
+
+	if a.receiver == nil {
+		return false
+	}
+	a.receiver <- *msg
+	return true
+}
+
+// Sent returns the recorded messages in order of sending.
+func (a *Adapter) Sent() []*message.OutMessage {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	sent := make([]*message.OutMessage, len(a.sent))
+	copy(sent, a.sent)
+	return sent
+}
+
+// Reset clears the recorded messages.
+func (a *Adapter) Reset() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.sent = nil
+}
@@ -0,0 +1,141 @@
+package mmbottest
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/yukithm/mmbot/message"
+)
+
+// Expect describes an expected sent message.
+// Zero value fields match any message.
+type Expect struct {
+	Text     string             // whole text
+	Contains string             // part of the text
+	Channel  string             // channel name or ID
+	RootID   string             // ID of the thread root post
+	ReplyTo  *message.InMessage // reply target message (compared by post ID)
+}
+
+// Match reports whether the message satisfies the expectation.
+func (e Expect) Match(msg *message.OutMessage) bool {
+	if e.Text != "" && msg.Text != e.Text {
+		return false
+	}
+	if e.Contains != "" && !strings.Contains(msg.Text, e.Contains) {
+		return false
+	}
+	if e.Channel != "" && msg.ChannelName != e.Channel && msg.ChannelID != e.Channel {
+		return false
+	}
+	if e.RootID != "" && msg.RootID != e.RootID {
+		return false
+	}
+	if e.ReplyTo != nil && !isReplyTo(msg, e.ReplyTo) {
+		return false
+	}
+	return true
+}
+
+func (e Expect) String() string {
+	var fields []string
+	if e.Text != "" {
+		fields = append(fields, fmt.Sprintf("text=%q", e.Text))
+	}
+	if e.Contains != "" {
+		fields = append(fields, fmt.Sprintf("contains=%q", e.Contains))
+	}
+	if e.Channel != "" {
+		fields = append(fields, fmt.Sprintf("channel=%q", e.Channel))
+	}
+	if e.RootID != "" {
+		fields = append(fields, fmt.Sprintf("root=%q", e.RootID))
+	}
+	if e.ReplyTo != nil {
+		fields = append(fields, fmt.Sprintf("reply to %q", e.ReplyTo.PostID))
+	}
+	if len(fields) == 0 {
+		return "any message"
+	}
+	return strings.Join(fields, " ")
+}
+
+// AssertSent checks that the robot has sent exactly the messages in order.
+func (h *Harness) AssertSent(t testing.TB, want ...Expect) {
+	t.Helper()
+
+	sent := h.Sent()
+	if len(sent) != len(want) {
+		t.Errorf("sent %d messages, want %d\n%s", len(sent), len(want), formatSent(sent))
+		return
+	}
+	for i, e := range want {
+		if !e.Match(sent[i]) {
+			t.Errorf("message #%d does not match %s\n%s", i, e, formatSent(sent))
+		}
+	}
+}
+
+// AssertAnySent checks that the robot has sent a message that satisfies the expectation.
+func (h *Harness) AssertAnySent(t testing.TB, want Expect) {
+	t.Helper()
+
+	sent := h.Sent()
+	for _, msg := range sent {
+		if want.Match(msg) {
+			return
+		}
+	}
+	t.Errorf("no message matches %s\n%s", want, formatSent(sent))
+}
+
+// AssertNothingSent checks that the robot has sent no messages.
+func (h *Harness) AssertNothingSent(t testing.TB) {
+	t.Helper()
+
+	if sent := h.Sent(); len(sent) > 0 {
+		t.Errorf("sent %d messages, want none\n%s", len(sent), formatSent(sent))
+	}
+}
+
+// AssertReply checks that the robot has replied the text to the message.
+// The mention to the user that Reply prepends is ignored.
+func (h *Harness) AssertReply(t testing.TB, in *message.InMessage, text string) {
+	t.Helper()
+
+	sent := h.Sent()
+	mention := "@" + in.UserName + " "
+	for _, msg := range sent {
+		if isReplyTo(msg, in) && strings.TrimPrefix(msg.Text, mention) == text {
+			return
+		}
+	}
+	t.Errorf("no reply %q to %q\n%s", text, in.Text, formatSent(sent))
+}
+
+// isReplyTo reports whether the message replies to in.
+// Handlers receive copies of the injected message, so they are compared by post ID.
+func isReplyTo(msg *message.OutMessage, in *message.InMessage) bool {
+	return msg.InReplyTo != nil && msg.InReplyTo.PostID == in.PostID
+}
+
+func formatSent(sent []*message.OutMessage) string {
+	if len(sent) == 0 {
+		return "sent messages: (none)"
+	}
+
+	lines := []string{"sent messages:"}
+	for i, msg := range sent {
+		channel := msg.ChannelName
+		if channel == "" {
+			channel = msg.ChannelID
+		}
+		line := fmt.Sprintf("  #%d [%s] %q", i, channel, msg.Text)
+		if msg.RootID != "" {
+			line += fmt.Sprintf(" (thread %s)", msg.RootID)
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
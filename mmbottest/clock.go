@@ -0,0 +1,44 @@
+package mmbottest
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultTime is the initial time of Clock.
+var DefaultTime = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Clock is a frozen clock. It moves only when Set or Add is called.
+type Clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewClock returns new clock frozen at the time.
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now}
+}
+
+// Now returns the current time of the clock.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+// Set sets the current time of the clock.
+func (c *Clock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = now
+}
+
+// Add moves the clock forward by d.
+func (c *Clock) Add(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+}
@@ -0,0 +1,173 @@
+package mmbottest
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron"
+	"github.com/yukithm/mmbot"
+	"github.com/yukithm/mmbot/brain"
+	"github.com/yukithm/mmbot/message"
+)
+
+// Default values of Harness.
+const (
+	DefaultBotName = "mmbot"
+	DefaultUser    = "user"
+	DefaultChannel = "town-square"
+)
+
+// Harness is a robot for testing handlers and jobs.
+// Messages are dispatched synchronously, so the sent messages can be checked
+// as soon as an inject method returns.
+type Harness struct {
+	Robot   *mmbot.Robot
+	Adapter *Adapter
+	Clock   *Clock
+
+	User    string // user name of injected messages (default: "user")
+	Channel string // channel name of injected messages (default: "town-square")
+
+	seq int
+}
+
+// New returns new harness with the handlers.
+// The robot uses the recording adapter and the frozen clock,
+// and its brain expires keys by the clock.
+func New(handlers ...mmbot.Handler) *Harness {
+	a := NewAdapter()
+	clock := NewClock(DefaultTime)
+	robot := mmbot.NewRobot(&mmbot.Config{
+		UserName:      DefaultBotName,
+		DisableServer: true,
+	}, a, nil)
+	robot.Handlers = handlers
+	robot.Clock = clock.Now
+	store := brain.NewMemory()
+	store.Clock = clock.Now
+	robot.Brain = store
+
+	return &Harness{
+		Robot:   robot,
+		Adapter: a,
+		Clock:   clock,
+		User:    DefaultUser,
+		Channel: DefaultChannel,
+	}
+}
+
+// Inject dispatches the message to the handlers and waits until they finish.
+// Empty user, channel and post fields are filled with the harness defaults.
+func (h *Harness) Inject(msg *message.InMessage) *message.InMessage {
+	h.seq++
+	if msg.UserName == "" {
+		msg.UserName = h.User
+	}
+	if msg.UserID == "" {
+		msg.UserID = msg.UserName
+	}
+	if msg.ChannelName == "" {
+		msg.ChannelName = h.Channel
+	}
+	if msg.ChannelID == "" {
+		msg.ChannelID = msg.ChannelName
+	}
+	if msg.PostID == "" {
+		msg.PostID = "post" + strconv.Itoa(h.seq)
+	}
+
+	h.Robot.Dispatch(msg)
+	return msg
+}
+
+// Public injects a public message.
+func (h *Harness) Public(text string) *message.InMessage {
+	return h.Inject(&message.InMessage{
+		Type: message.PublicMessage,
+		Text: text,
+	})
+}
+
+// Mention injects a mention to the bot.
+// The mention is prepended to the text unless it starts with "@".
+func (h *Harness) Mention(text string) *message.InMessage {
+	if !strings.HasPrefix(text, "@") {
+		text = "@" + h.Robot.Config.UserName + " " + text
+	}
+	return h.Inject(&message.InMessage{
+		Type: message.MentionMessage,
+		Text: text,
+	})
+}
+
+// Direct injects a direct message to the bot.
+func (h *Harness) Direct(text string) *message.InMessage {
+	return h.Inject(&message.InMessage{
+		Type:        message.DirectMessage,
+		ChannelName: "@" + h.User,
+		Text:        text,
+	})
+}
+
+// Command injects a slash command such as "/deploy production".
+func (h *Harness) Command(text string) *message.InMessage {
+	var command string
+	if fields := strings.Fields(text); len(fields) > 0 {
+		command = fields[0]
+	}
+	return h.Inject(&message.InMessage{
+		Type:      message.CommandMessage,
+		Command:   command,
+		TriggerID: "trigger" + strconv.Itoa(h.seq+1),
+		Text:      text,
+	})
+}
+
+// Sent returns the messages sent by the robot in order of sending.
+func (h *Harness) Sent() []*message.OutMessage {
+	return h.Adapter.Sent()
+}
+
+// Reset clears the sent messages.
+func (h *Harness) Reset() {
+	h.Adapter.Reset()
+}
+
+// Advance moves the clock forward by d and runs the jobs scheduled in the meantime.
+func (h *Harness) Advance(d time.Duration) error {
+	return h.AdvanceTo(h.Clock.Now().Add(d))
+}
+
+// AdvanceTo moves the clock to t and runs the jobs scheduled in the meantime.
+// The jobs run in order of their schedule, and the clock is set to the
+// scheduled time while each job runs.
+func (h *Harness) AdvanceTo(t time.Time) error {
+	type dueJob struct {
+		at  time.Time
+		job mmbot.Job
+	}
+
+	from := h.Clock.Now()
+	var due []dueJob
+	for _, job := range h.Robot.Jobs {
+		schedule, err := cron.Parse(job.Schedule)
+		if err != nil {
+			return err
+		}
+		for next := schedule.Next(from); !next.IsZero() && !next.After(t); next = schedule.Next(next) {
+			due = append(due, dueJob{at: next, job: job})
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool {
+		return due[i].at.Before(due[j].at)
+	})
+
+	for _, d := range due {
+		h.Clock.Set(d.at)
+		d.job.Action(h.Robot)
+	}
+	h.Clock.Set(t)
+	return nil
+}
@@ -0,0 +1,247 @@
+package mmbottest_test
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/yukithm/mmbot"
+	"github.com/yukithm/mmbot/brain"
+	"github.com/yukithm/mmbot/message"
+	"github.com/yukithm/mmbot/mmbottest"
+)
+
+// recorder is testing.TB that records errors instead of failing the test.
+type recorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func echoHandler() mmbot.Handler {
+	return mmbot.PatternHandler{
+		MessageType: message.MentionMessage | message.DirectMessage,
+		Pattern:     regexp.MustCompile(`\Aecho (.+)`),
+		Action: func(msg *message.InMessage) error {
+			return msg.Reply(msg.Matches[1])
+		},
+	}
+}
+
+func TestInject(t *testing.T) {
+	h := mmbottest.New(echoHandler())
+
+	in := h.Inject(&message.InMessage{Type: message.MentionMessage, Text: "@mmbot echo hi"})
+	if in.UserName != mmbottest.DefaultUser || in.ChannelName != mmbottest.DefaultChannel || in.PostID == "" {
+		t.Errorf("defaults are not filled: %+v", in)
+	}
+	h.AssertReply(t, in, "hi")
+
+	h.Reset()
+	h.User = "alice"
+	in = h.Direct("echo secret")
+	if in.ChannelName != "@alice" || in.Type != message.DirectMessage {
+		t.Errorf("direct message = %+v", in)
+	}
+	h.AssertSent(t, mmbottest.Expect{Text: "@alice secret", Channel: "@alice", ReplyTo: in})
+}
+
+func TestMention(t *testing.T) {
+	h := mmbottest.New(echoHandler())
+
+	h.Public("echo ignored")
+	h.AssertNothingSent(t)
+
+	in := h.Mention("echo hello")
+	if in.Text != "@mmbot echo hello" {
+		t.Errorf("Text = %q, want %q", in.Text, "@mmbot echo hello")
+	}
+	h.AssertReply(t, in, "hello")
+	h.AssertAnySent(t, mmbottest.Expect{Contains: "hello", Channel: mmbottest.DefaultChannel})
+
+	h.Reset()
+	h.Mention("@other echo hello")
+	h.AssertNothingSent(t)
+}
+
+func TestCommand(t *testing.T) {
+	h := mmbottest.New(mmbot.CommandHandler{
+		Commands: []mmbot.Command{
+			{
+				Name: "greet",
+				Args: []mmbot.CommandArg{{Name: "name"}},
+				Action: func(msg *message.InMessage) error {
+					return msg.Reply("hello " + msg.Args.String("name") + " " + msg.TriggerID)
+				},
+			},
+		},
+	})
+
+	in := h.Command("/greet bob")
+	if in.Type != message.CommandMessage || in.Command != "/greet" || in.TriggerID == "" {
+		t.Errorf("command = %+v", in)
+	}
+	h.AssertReply(t, in, "hello bob "+in.TriggerID)
+}
+
+func TestAssertSentFailures(t *testing.T) {
+	h := mmbottest.New(echoHandler())
+	in := h.Mention("echo one")
+	h.Mention("echo two")
+
+	tests := []struct {
+		name   string
+		assert func(t testing.TB)
+	}{
+		{"count", func(t testing.TB) { h.AssertSent(t, mmbottest.Expect{}) }},
+		{"order", func(t testing.TB) {
+			h.AssertSent(t, mmbottest.Expect{Contains: "two"}, mmbottest.Expect{Contains: "one"})
+		}},
+		{"any", func(t testing.TB) { h.AssertAnySent(t, mmbottest.Expect{Text: "three"}) }},
+		{"nothing", func(t testing.TB) { h.AssertNothingSent(t) }},
+		{"reply text", func(t testing.TB) { h.AssertReply(t, in, "two") }},
+		{"reply target", func(t testing.TB) { h.AssertReply(t, &message.InMessage{PostID: "unknown"}, "one") }},
+	}
+	for _, tt := range tests {
+		r := &recorder{TB: t}
+		tt.assert(r)
+		if len(r.errors) == 0 {
+			t.Errorf("%s: assertion passed, want failure", tt.name)
+		}
+	}
+
+	r := &recorder{TB: t}
+	h.AssertSent(r, mmbottest.Expect{Contains: "one", ReplyTo: in}, mmbottest.Expect{Contains: "two"})
+	if len(r.errors) > 0 {
+		t.Errorf("AssertSent failed: %v", r.errors)
+	}
+}
+
+func TestAdvanceTo(t *testing.T) {
+	h := mmbottest.New()
+	var runs []time.Time
+	h.Robot.Jobs = []mmbot.Job{
+		{
+			Schedule: "0 0 9 * * *",
+			Action: func(bot *mmbot.Robot) {
+				runs = append(runs, bot.Now())
+				bot.Send(&message.OutMessage{ChannelName: "general", Text: "good morning"})
+			},
+		},
+	}
+
+	if err := h.Advance(8 * time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	h.AssertNothingSent(t)
+
+	end := mmbottest.DefaultTime.Add(48 * time.Hour)
+	if err := h.AdvanceTo(end); err != nil {
+		t.Fatal(err)
+	}
+	want := []time.Time{
+		mmbottest.DefaultTime.Add(9 * time.Hour),
+		mmbottest.DefaultTime.Add(33 * time.Hour),
+	}
+	if len(runs) != len(want) || !runs[0].Equal(want[0]) || !runs[1].Equal(want[1]) {
+		t.Errorf("job ran at %v, want %v", runs, want)
+	}
+	if now := h.Clock.Now(); !now.Equal(end) {
+		t.Errorf("clock = %v, want %v", now, end)
+	}
+	h.AssertSent(t,
+		mmbottest.Expect{Text: "good morning", Channel: "general"},
+		mmbottest.Expect{Text: "good morning", Channel: "general"},
+	)
+}
+
+func TestAdvanceToInvalidSchedule(t *testing.T) {
+	h := mmbottest.New()
+	h.Robot.Jobs = []mmbot.Job{{Schedule: "invalid", Action: func(*mmbot.Robot) {}}}
+
+	if err := h.Advance(time.Hour); err == nil {
+		t.Error("Advance() with an invalid schedule succeeded")
+	}
+}
+
+func TestBrainTTL(t *testing.T) {
+	h := mmbottest.New()
+	if err := h.Robot.Brain.SetWithTTL("key", []byte("value"), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	h.Advance(59 * time.Minute)
+	if _, err := h.Robot.Brain.Get("key"); err != nil {
+		t.Errorf("Get() before expiration = %v", err)
+	}
+	h.Advance(time.Minute)
+	if _, err := h.Robot.Brain.Get("key"); err != brain.ErrNotFound {
+		t.Errorf("Get() after expiration = %v, want %v", err, brain.ErrNotFound)
+	}
+}
+
+func TestAdapterStop(t *testing.T) {
+	a := mmbottest.NewAdapter()
+	in, errCh := a.Start()
+	a.Stop()
+
+	if _, ok := <-in; ok {
+		t.Error("receiver is not closed")
+	}
+	if _, ok := <-errCh; ok {
+		t.Error("error channel is not closed")
+	}
+
+	if a.Receive(&message.InMessage{Text: "ignored"}) {
+		t.Error("Receive() after Stop() delivered the message")
+	}
+	a.Stop()
+}
+
+func TestAdapterReceive(t *testing.T) {
+	h := mmbottest.New(echoHandler())
+	h.Robot.Config.DisableServer = true
+
+	// the robot can be started again after it stops
+	for _, text := range []string{"first", "second"} {
+		errCh := h.Robot.Start()
+		msg := &message.InMessage{
+			Type:        message.DirectMessage,
+			ChannelName: "@user",
+			UserName:    "user",
+			Text:        "echo " + text,
+		}
+
+		// the adapter is started in the background
+		deadline := time.Now().Add(5 * time.Second)
+		for !h.Adapter.Receive(msg) && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		for len(h.Sent()) == 0 && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		h.Robot.Stop()
+		for err := range errCh {
+			t.Error(err)
+		}
+
+		h.AssertSent(t, mmbottest.Expect{Text: "@user " + text, Channel: "@user"})
+		h.Reset()
+	}
+}
+
+func Example() {
+	h := mmbottest.New(echoHandler())
+
+	h.Mention("echo hello")
+	for _, msg := range h.Sent() {
+		fmt.Println(msg.Text)
+	}
+	// Output: @user hello
+}
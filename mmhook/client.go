@@ -4,7 +4,7 @@ package mmhook
 import (
 	"bytes"
 	"crypto/tls"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -13,6 +13,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gorilla/schema"
@@ -20,9 +21,16 @@ import (
 	"github.com/yukithm/mmbot/message"
 )
 
+// ErrNoOutgoingURL is returned when a message cannot be sent because no outgoing URL is configured for the channel.
+var ErrNoOutgoingURL = errors.New("mmhook: outgoing URL is not configured")
+
+// ErrNoServerURL is returned when a dialog cannot be opened because no server URL is configured.
+var ErrNoServerURL = errors.New("mmhook: server URL is not configured")
+
 // SendError represents an error of sending message.
 type SendError struct {
 	Err                error
+	StatusCode         int
 	RatelimitLimit     int
 	RatelimitRemaining int
 	RatelimitReset     int
@@ -46,6 +54,18 @@ type Client struct {
 	tokens map[string]int
 	in     chan message.InMessage
 	errCh  chan error
+
+	commandTokens map[string]int
+	mu            sync.Mutex
+	pending       map[interface{}]chan *CommandResponse // requests waiting for the response by raw message
+
+	sendMu     sync.RWMutex
+	queue      chan *sendRequest // nil if not started
+	senderDone chan struct{}
+	enqueuing  sync.WaitGroup // senders putting messages into the queue
+
+	limitMu      sync.Mutex
+	limitedUntil time.Time // time when the rate limit resets
 }
 
 // NewClient returns new mattermost webhook client.
@@ -54,8 +74,9 @@ func NewClient(config *adapter.Config, logger *log.Logger) *Client {
 		logger = log.New(ioutil.Discard, "", 0)
 	}
 	c := &Client{
-		config: config,
-		logger: logger,
+		config:  config,
+		logger:  logger,
+		pending: make(map[interface{}]chan *CommandResponse),
 	}
 
 	tr := &http.Transport{
@@ -73,34 +94,68 @@ func NewClient(config *adapter.Config, logger *log.Logger) *Client {
 	}
 	c.http = &http.Client{Transport: tr}
 
-	// build token lookup table
-	c.tokens = make(map[string]int, len(config.Tokens))
-	for i, token := range config.Tokens {
+	c.tokens = tokenTable(config.Tokens)
+	c.commandTokens = tokenTable(config.CommandTokens)
+
+	return c
+}
+
+// tokenTable builds token lookup table.
+func tokenTable(tokens []string) map[string]int {
+	table := make(map[string]int, len(tokens))
+	for i, token := range tokens {
 		token = strings.TrimSpace(token)
 		if token != "" {
-			c.tokens[token] = i
+			table[token] = i
 		}
 	}
-
-	return c
+	return table
 }
 
 // Start starts the communication with Mattermost.
 func (c *Client) Start() (chan message.InMessage, chan error) {
 	c.in = make(chan message.InMessage, 1)
 	c.errCh = make(chan error, 1)
+	c.startSender()
 	return c.in, c.errCh
 }
 
 // Stop terminates the communication.
+// Queued messages are sent before it returns.
 func (c *Client) Stop() {
+	c.stopSender()
 	close(c.in)
 	close(c.errCh)
 }
 
 // Send sends a message to Mattermost.
+// A reply to a slash command is sent as the response of the command.
+// If SyncResponse is enabled, the first reply to an outgoing webhook is sent as
+// the response of the webhook while the webhook waits for it.
+// Other messages are queued while the client is started, and Send returns
+// without waiting for them to be sent; errors of sending are logged.
 func (c *Client) Send(msg *message.OutMessage) error {
+	if cmd := repliedCommand(msg); cmd != nil {
+		return c.respondCommand(cmd, msg)
+	}
+	if in := repliedWebhook(msg); in != nil && c.config.SyncResponse {
+		if c.respond(in, c.overrideResponse(translateWebhookResponse(msg))) {
+			return nil
+		}
+	}
+
+	return c.sendWebhook(msg)
+}
+
+// sendWebhook sends the message via the incoming webhook on Mattermost.
+// The URL is chosen by the channel of the message.
+func (c *Client) sendWebhook(msg *message.OutMessage) error {
 	om := translateOutMessage(msg)
+	url := c.outgoingURL(om.Channel)
+	if url == "" {
+		return ErrNoOutgoingURL
+	}
+
 	if c.config.OverrideUserName != "" && om.UserName == "" {
 		om.UserName = c.config.OverrideUserName
 	}
@@ -108,24 +163,16 @@ func (c *Client) Send(msg *message.OutMessage) error {
 		om.IconURL = c.config.IconURL
 	}
 
-	buf, err := json.Marshal(om)
-	if err != nil {
-		return err
-	}
-
-	res, err := c.http.Post(c.config.OutgoingURL, "application/json", bytes.NewReader(buf))
-	if err != nil {
-		return err
-	}
-	defer res.Body.Close()
+	return c.enqueue(url, om)
+}
 
-	if res.StatusCode == 200 {
-		io.Copy(ioutil.Discard, res.Body)
-	} else {
-		return newSendError(res)
+// outgoingURL returns the webhook URL for the channel.
+// It returns OutgoingURL if the channel has no URL in OutgoingURLs.
+func (c *Client) outgoingURL(channel string) string {
+	if url, ok := c.config.OutgoingURLs[channel]; ok && url != "" {
+		return url
 	}
-
-	return nil
+	return c.config.OutgoingURL
 }
 
 // IncomingWebHook returns webhook. It will be disabled if nil.
@@ -165,7 +212,13 @@ func (c *Client) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	im := translateInMessage(&msg)
-	c.in <- *im
+	if !c.config.SyncResponse {
+		c.in <- *im
+		return
+	}
+
+	res := c.waitResponse(&msg, im)
+	c.writeResponse(w, res)
 }
 
 func (c *Client) validToken(token string) bool {
@@ -173,12 +226,13 @@ func (c *Client) validToken(token string) bool {
 	return ok
 }
 
-func decodeForm(msg *InMessage, r *http.Request) error {
+func decodeForm(msg interface{}, r *http.Request) error {
 	if err := r.ParseForm(); err != nil {
 		return err
 	}
 
 	decoder := schema.NewDecoder()
+	decoder.IgnoreUnknownKeys(true)
 	if err := decoder.Decode(msg, r.PostForm); err != nil {
 		return err
 	}
@@ -191,6 +245,7 @@ func newSendError(res *http.Response) SendError {
 	io.Copy(&body, res.Body)
 	return SendError{
 		Err:                fmt.Errorf("Failed to send a message (%s)", res.Status),
+		StatusCode:         res.StatusCode,
 		RatelimitLimit:     getHeaderInt(res.Header, "X-Ratelimit-Limit"),
 		RatelimitRemaining: getHeaderInt(res.Header, "X-Ratelimit-Remaining"),
 		RatelimitReset:     getHeaderInt(res.Header, "X-Ratelimit-Reset"),
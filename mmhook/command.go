@@ -0,0 +1,89 @@
+package mmhook
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/yukithm/mmbot/adapter"
+	"github.com/yukithm/mmbot/message"
+)
+
+// SlashCommandHook returns webhook for slash commands. It will be disabled if nil.
+func (c *Client) SlashCommandHook() *adapter.IncomingWebHook {
+	if c.config.CommandPath == "" {
+		return nil
+	}
+	return &adapter.IncomingWebHook{
+		Path:    c.config.CommandPath,
+		Handler: c.ServeCommand,
+	}
+}
+
+// ServeCommand receives a slash command from Mattermost.
+// The first reply to the command within the response timeout is written as the response.
+func (c *Client) ServeCommand(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		c.logger.Printf("Invalid %q request from %q", r.Method, r.RemoteAddr)
+		http.Error(w, "405 Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	cmd := &SlashCommand{}
+	if err := decodeForm(cmd, r); err != nil {
+		c.logger.Printf("Invalid form data: %v", err)
+		http.Error(w, "400 Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	if len(c.commandTokens) > 0 {
+		if cmd.Token == "" {
+			c.logger.Printf("No token request from %q", r.RemoteAddr)
+			http.Error(w, "400 Bad Request", http.StatusBadRequest)
+			return
+		} else if _, ok := c.commandTokens[cmd.Token]; !ok {
+			c.logger.Printf("Invalid token %q request from %q", cmd.Token, r.RemoteAddr)
+			http.Error(w, "400 Bad Request", http.StatusBadRequest)
+			return
+		}
+	}
+
+	res := c.waitResponse(cmd, translateCommand(cmd))
+	c.writeResponse(w, res)
+}
+
+// respondCommand sends the message as the response of the slash command.
+// It is posted to the response URL if the synchronous response is over.
+func (c *Client) respondCommand(cmd *SlashCommand, msg *message.OutMessage) error {
+	res := c.overrideResponse(translateCommandResponse(msg))
+	if c.respond(cmd, res) {
+		return nil
+	}
+	if cmd.ResponseURL != "" {
+		return c.postWithRetry(cmd.ResponseURL, res)
+	}
+
+	return c.sendWebhook(msg)
+}
+
+// OpenDialog opens the dialog for the trigger ID.
+// It requires ServerURL of the config.
+func (c *Client) OpenDialog(triggerID string, url string, dialog *message.Dialog) error {
+	if c.config.ServerURL == "" {
+		return ErrNoServerURL
+	}
+
+	return c.post(strings.TrimSuffix(c.config.ServerURL, "/")+"/api/v4/actions/dialogs/open", &OpenDialogRequest{
+		TriggerID: triggerID,
+		URL:       url,
+		Dialog:    dialog,
+	})
+}
+
+// repliedCommand returns the slash command that the message replies to.
+func repliedCommand(msg *message.OutMessage) *SlashCommand {
+	if msg.InReplyTo == nil {
+		return nil
+	}
+	cmd, _ := msg.InReplyTo.RawMessage.(*SlashCommand)
+	return cmd
+}
@@ -1,5 +1,7 @@
 package mmhook
 
+import "github.com/yukithm/mmbot/message"
+
 // InMessage represents a message from Mattermost outgouing webhook.
 // (received from Mattermost)
 type InMessage struct {
@@ -8,6 +10,7 @@ type InMessage struct {
 	TeamDomain  string `schema:"team_domain"`
 	TeamID      string `schema:"team_id"`
 	Text        string `schema:"text"`
+	PostID      string `schema:"post_id"`
 	Timestamp   string `schema:"timestamp"`
 	Token       string `schema:"token"`
 	TriggerWord string `schema:"trigger_word"`
@@ -15,11 +18,58 @@ type InMessage struct {
 	UserName    string `schema:"user_name"`
 }
 
+// SlashCommand represents a request from Mattermost slash command.
+// (received from Mattermost)
+type SlashCommand struct {
+	ChannelID   string `schema:"channel_id"`
+	ChannelName string `schema:"channel_name"`
+	Command     string `schema:"command"`
+	ResponseURL string `schema:"response_url"`
+	TeamDomain  string `schema:"team_domain"`
+	TeamID      string `schema:"team_id"`
+	Text        string `schema:"text"`
+	Token       string `schema:"token"`
+	TriggerID   string `schema:"trigger_id"`
+	UserID      string `schema:"user_id"`
+	UserName    string `schema:"user_name"`
+}
+
+// Response types of slash commands and outgoing webhooks.
+const (
+	ResponseEphemeral = "ephemeral"  // slash command only
+	ResponseInChannel = "in_channel" // slash command only
+	ResponseComment   = "comment"    // outgoing webhook only; reply in the thread
+)
+
+// CommandResponse represents a response to Mattermost slash command or outgoing webhook.
+// (send to Mattermost)
+type CommandResponse struct {
+	ResponseType string                 `json:"response_type,omitempty"`
+	Text         string                 `json:"text,omitempty"`
+	UserName     string                 `json:"username,omitempty"`
+	IconURL      string                 `json:"icon_url,omitempty"`
+	Attachments  []*message.Attachment  `json:"attachments,omitempty"`
+	Props        map[string]interface{} `json:"props,omitempty"`
+	Type         string                 `json:"type,omitempty"`
+}
+
+// OpenDialogRequest represents a request to open an interactive dialog.
+// (send to Mattermost)
+type OpenDialogRequest struct {
+	TriggerID string          `json:"trigger_id"`
+	URL       string          `json:"url"`
+	Dialog    *message.Dialog `json:"dialog"`
+}
+
 // OutMessage represents a message to Mattermost incomig webhook.
 // (send to Mattermost)
 type OutMessage struct {
-	Text     string `json:"text,omitempty"`
-	Channel  string `json:"channel,omitempty"`
-	UserName string `json:"username,omitempty"`
-	IconURL  string `json:"icon_url,omitempty"`
+	Text        string                 `json:"text,omitempty"`
+	Channel     string                 `json:"channel,omitempty"`
+	UserName    string                 `json:"username,omitempty"`
+	IconURL     string                 `json:"icon_url,omitempty"`
+	RootID      string                 `json:"root_id,omitempty"`
+	Attachments []*message.Attachment  `json:"attachments,omitempty"`
+	Props       map[string]interface{} `json:"props,omitempty"`
+	Type        string                 `json:"type,omitempty"`
 }
@@ -0,0 +1,91 @@
+package mmhook
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/yukithm/mmbot/message"
+)
+
+// DefaultResponseTimeout is the default time to wait for the synchronous response.
+// Mattermost gives up waiting for the response after a few seconds.
+const DefaultResponseTimeout = 2500 * time.Millisecond
+
+// waitResponse passes the message to the robot and waits for the first reply to it.
+// The key is the raw message that replies refer to.
+// It returns nil if no reply is sent within the response timeout.
+func (c *Client) waitResponse(key interface{}, msg *message.InMessage) *CommandResponse {
+	ch := make(chan *CommandResponse, 1)
+	c.mu.Lock()
+	c.pending[key] = ch
+	c.mu.Unlock()
+
+	c.in <- *msg
+
+	timeout := c.config.ResponseTimeout
+	if timeout == 0 {
+		timeout = DefaultResponseTimeout
+	}
+
+	select {
+	case res := <-ch:
+		return res
+	case <-time.After(timeout):
+		c.mu.Lock()
+		_, waiting := c.pending[key]
+		delete(c.pending, key)
+		c.mu.Unlock()
+		if !waiting {
+			// the reply has been passed just now
+			return <-ch
+		}
+		return nil
+	}
+}
+
+// respond passes the response to the request that waits for it.
+// It returns false if the request does not wait any longer.
+func (c *Client) respond(key interface{}, res *CommandResponse) bool {
+	c.mu.Lock()
+	ch, waiting := c.pending[key]
+	delete(c.pending, key)
+	c.mu.Unlock()
+
+	if waiting {
+		ch <- res
+	}
+	return waiting
+}
+
+// writeResponse writes the response as JSON, or an empty response if nil.
+func (c *Client) writeResponse(w http.ResponseWriter, res *CommandResponse) {
+	if res == nil {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		c.logger.Printf("Failed to write response: %v", err)
+	}
+}
+
+func (c *Client) overrideResponse(res *CommandResponse) *CommandResponse {
+	if c.config.OverrideUserName != "" && res.UserName == "" {
+		res.UserName = c.config.OverrideUserName
+	}
+	if c.config.IconURL != "" && res.IconURL == "" {
+		res.IconURL = c.config.IconURL
+	}
+	return res
+}
+
+// repliedWebhook returns the outgoing webhook message that the message replies to.
+func repliedWebhook(msg *message.OutMessage) *InMessage {
+	if msg.InReplyTo == nil {
+		return nil
+	}
+	in, _ := msg.InReplyTo.RawMessage.(*InMessage)
+	return in
+}
@@ -0,0 +1,181 @@
+package mmhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// Default values of the send pipeline.
+const (
+	DefaultSendQueueSize = 100
+	DefaultSendRetries   = 3
+
+	initialBackoff = 1 * time.Second
+	maxBackoff     = 30 * time.Second
+)
+
+// sendRequest is a message waiting in the send queue.
+type sendRequest struct {
+	url  string
+	body interface{}
+}
+
+// startSender starts the goroutine that sends queued messages one by one.
+func (c *Client) startSender() {
+	size := c.config.SendQueueSize
+	if size <= 0 {
+		size = DefaultSendQueueSize
+	}
+
+	c.sendMu.Lock()
+	c.queue = make(chan *sendRequest, size)
+	c.senderDone = make(chan struct{})
+	c.sendMu.Unlock()
+
+	go c.sendLoop(c.queue, c.senderDone)
+}
+
+// stopSender sends the remaining messages and stops the goroutine.
+func (c *Client) stopSender() {
+	c.sendMu.Lock()
+	queue, done := c.queue, c.senderDone
+	c.queue = nil
+	c.sendMu.Unlock()
+
+	if queue == nil {
+		return
+	}
+	// messages being queued must be in the queue before it is closed
+	c.enqueuing.Wait()
+	close(queue)
+	<-done
+}
+
+func (c *Client) sendLoop(queue chan *sendRequest, done chan struct{}) {
+	defer close(done)
+	for req := range queue {
+		if err := c.postWithRetry(req.url, req.body); err != nil {
+			c.logger.Printf("Failed to send a message: %v", err)
+		}
+	}
+}
+
+// enqueue puts the message into the send queue and returns without waiting
+// until it is sent. Errors of sending are logged.
+// It blocks while the queue is full. The message is sent immediately if the
+// client is not started.
+func (c *Client) enqueue(url string, body interface{}) error {
+	c.sendMu.RLock()
+	queue := c.queue
+	if queue != nil {
+		c.enqueuing.Add(1)
+	}
+	c.sendMu.RUnlock()
+
+	if queue == nil {
+		return c.postWithRetry(url, body)
+	}
+	defer c.enqueuing.Done()
+
+	queue <- &sendRequest{url: url, body: body}
+	return nil
+}
+
+// postWithRetry posts the value as JSON to the URL.
+// Network errors and 5xx/429 responses are retried with exponential backoff,
+// and requests wait for the reset of the rate limit when no request remains.
+func (c *Client) postWithRetry(url string, v interface{}) error {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	retries := c.config.SendRetries
+	if retries == 0 {
+		retries = DefaultSendRetries
+	}
+
+	backoff := initialBackoff
+	for attempt := 0; ; attempt++ {
+		c.waitRatelimit()
+
+		err = c.postJSON(url, buf)
+		if err == nil || !retryable(err) || attempt >= retries {
+			return err
+		}
+
+		c.logger.Printf("Failed to send a message (retry in %s): %v", backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// post posts the value as JSON to the URL without retries.
+func (c *Client) post(url string, v interface{}) error {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	c.waitRatelimit()
+	return c.postJSON(url, buf)
+}
+
+func (c *Client) postJSON(url string, buf []byte) error {
+	res, err := c.http.Post(url, "application/json", bytes.NewReader(buf))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	c.updateRatelimit(res.Header)
+
+	if res.StatusCode != http.StatusOK {
+		return newSendError(res)
+	}
+	io.Copy(ioutil.Discard, res.Body)
+
+	return nil
+}
+
+// updateRatelimit records the time when the rate limit resets if no request remains.
+func (c *Client) updateRatelimit(header http.Header) {
+	if getHeaderInt(header, "X-Ratelimit-Remaining") != 0 {
+		return
+	}
+	reset := getHeaderInt(header, "X-Ratelimit-Reset")
+	if reset < 0 {
+		return
+	}
+
+	c.limitMu.Lock()
+	c.limitedUntil = time.Now().Add(time.Duration(reset) * time.Second)
+	c.limitMu.Unlock()
+}
+
+// waitRatelimit waits until the rate limit resets.
+func (c *Client) waitRatelimit() {
+	c.limitMu.Lock()
+	wait := time.Until(c.limitedUntil)
+	c.limitMu.Unlock()
+
+	if wait > 0 {
+		c.logger.Printf("Rate limit exceeded; wait %s", wait)
+		time.Sleep(wait)
+	}
+}
+
+// retryable returns true if the error is a network error or a 5xx/429 response.
+func retryable(err error) bool {
+	e, ok := err.(SendError)
+	if !ok {
+		return true
+	}
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests
+}
@@ -1,48 +1,80 @@
 package mmhook
 
 import (
-	"strings"
-
+	"github.com/yukithm/mmbot/internal/webhook"
 	"github.com/yukithm/mmbot/message"
 )
 
 func translateInMessage(msg *InMessage) *message.InMessage {
 	return &message.InMessage{
-		Type:        messageType(msg),
+		Type:        webhook.MessageType(msg.ChannelName, msg.Text),
 		ChannelID:   msg.ChannelID,
 		ChannelName: msg.ChannelName,
 		UserID:      msg.UserID,
 		UserName:    msg.UserName,
+		PostID:      msg.PostID,
 		Text:        msg.Text,
 		RawMessage:  msg,
 	}
 }
 
-func translateOutMessage(msg *message.OutMessage) *OutMessage {
-	var channel string
-	if msg.InReplyTo != nil {
-		channel = msg.InReplyTo.ChannelName
-	} else if msg.TriggeredBy != nil {
-		channel = msg.TriggeredBy.ChannelName
-	} else {
-		channel = msg.ChannelName
+func translateCommand(cmd *SlashCommand) *message.InMessage {
+	return &message.InMessage{
+		Type:        message.CommandMessage,
+		ChannelID:   cmd.ChannelID,
+		ChannelName: cmd.ChannelName,
+		UserID:      cmd.UserID,
+		UserName:    cmd.UserName,
+		Command:     cmd.Command,
+		TriggerID:   cmd.TriggerID,
+		Text:        webhook.CommandText(cmd.Command, cmd.Text),
+		RawMessage:  cmd,
 	}
+}
 
-	return &OutMessage{
-		Text:     msg.Text,
-		Channel:  channel,
-		UserName: msg.UserName,
-		IconURL:  msg.IconURL,
+func translateCommandResponse(msg *message.OutMessage) *CommandResponse {
+	responseType := ResponseInChannel
+	if msg.Ephemeral {
+		responseType = ResponseEphemeral
+	}
+
+	return &CommandResponse{
+		ResponseType: responseType,
+		Text:         msg.Text,
+		UserName:     msg.UserName,
+		IconURL:      msg.IconURL,
+		Attachments:  msg.Attachments,
+		Props:        msg.Props,
+		Type:         msg.Type,
 	}
 }
 
-func messageType(msg *InMessage) message.Type {
-	if strings.HasPrefix(msg.ChannelName, "@") {
-		return message.DirectMessage
+func translateWebhookResponse(msg *message.OutMessage) *CommandResponse {
+	var responseType string
+	if msg.RootID != "" {
+		responseType = ResponseComment
 	}
-	if strings.HasPrefix(msg.Text, "@") {
-		return message.MentionMessage
+
+	return &CommandResponse{
+		ResponseType: responseType,
+		Text:         msg.Text,
+		UserName:     msg.UserName,
+		IconURL:      msg.IconURL,
+		Attachments:  msg.Attachments,
+		Props:        msg.Props,
+		Type:         msg.Type,
 	}
+}
 
-	return message.PublicMessage
+func translateOutMessage(msg *message.OutMessage) *OutMessage {
+	return &OutMessage{
+		Text:        msg.Text,
+		Channel:     webhook.OutChannel(msg),
+		UserName:    msg.UserName,
+		IconURL:     msg.IconURL,
+		RootID:      msg.RootID,
+		Attachments: msg.Attachments,
+		Props:       msg.Props,
+		Type:        msg.Type,
+	}
 }
@@ -0,0 +1,74 @@
+package mmbot
+
+import (
+	"sync"
+	"time"
+)
+
+// tokenBucket is a token bucket rate limiter.
+// It holds up to burst tokens and refills a token every interval.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter manages token buckets by key.
+type rateLimiter struct {
+	burst    int
+	interval time.Duration
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+func newRateLimiter(burst int, interval time.Duration) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{
+		burst:    burst,
+		interval: interval,
+		buckets:  make(map[string]*tokenBucket),
+	}
+}
+
+// allow takes a token of the key and returns true if it is available.
+func (l *rateLimiter) allow(key string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(l.burst), last: now}
+		l.buckets[key] = b
+	}
+
+	if l.interval > 0 {
+		b.tokens += float64(now.Sub(b.last)) / float64(l.interval)
+		if b.tokens > float64(l.burst) {
+			b.tokens = float64(l.burst)
+		}
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+
+	l.cleanup(now)
+	return true
+}
+
+// cleanup removes full buckets to bound the memory. l.mu must be locked by the caller.
+func (l *rateLimiter) cleanup(now time.Time) {
+	if len(l.buckets) < 1024 {
+		return
+	}
+	full := time.Duration(l.burst) * l.interval
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= full {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package mmbot
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiterRefill(t *testing.T) {
+	start := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		key   string
+		after time.Duration // since start
+		want  bool
+	}{
+		{"burst 1", "alice", 0, true},
+		{"burst 2", "alice", 0, true},
+		{"empty", "alice", time.Second, false},
+		{"other key", "bob", time.Second, true},
+		{"half a token", "alice", 5 * time.Second, false},
+		{"refilled", "alice", 10 * time.Second, true},
+		{"empty again", "alice", 10 * time.Second, false},
+		// the tokens are capped at burst however long it waits
+		{"full 1", "alice", time.Hour, true},
+		{"full 2", "alice", time.Hour, true},
+		{"full 3", "alice", time.Hour, false},
+	}
+
+	l := newRateLimiter(2, 10*time.Second)
+	for _, tt := range tests {
+		if got := l.allow(tt.key, start.Add(tt.after)); got != tt.want {
+			t.Errorf("%s: allow(%q) = %v, want %v", tt.name, tt.key, got, tt.want)
+		}
+	}
+}
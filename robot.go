@@ -1,44 +1,69 @@
 package mmbot
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
-	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/robfig/cron"
 	"github.com/yukithm/mmbot/adapter"
+	"github.com/yukithm/mmbot/brain"
 	"github.com/yukithm/mmbot/message"
 )
 
 // Robot is a main controller of the bot.
 type Robot struct {
-	Config     *Config
-	Client     adapter.Adapter
-	Handlers   []Handler
-	Routes     []Route
-	Jobs       []Job
-	scheduler  *cron.Cron
-	Logger     *log.Logger
-	workerJobs chan workerJob
-	aborted    bool
-	quit       chan struct{}
-	errCh      chan error
+	Config         *Config
+	Client         adapter.Adapter
+	Adapters       map[string]adapter.Adapter // additional adapters by name
+	Handlers       []Handler
+	Fallback       Handler // runs only when no other handler can handle the message
+	Routes         []Route
+	Actions        []ActionHandler // handlers of interactive message actions
+	Dialogs        []DialogHandler // handlers of interactive dialog submissions
+	Jobs           []Job
+	Brain          brain.Brain
+	Clock          func() time.Time // current time for Now (default: time.Now)
+	scheduler      *cron.Cron
+	Logger         *log.Logger
+	middlewares    []Middleware
+	workerJobs     chan workerJob
+	workers        sync.WaitGroup
+	runningJobs    sync.WaitGroup
+	server         *http.Server
+	ctx            context.Context
+	cancel         context.CancelFunc
+	adaptersQuit   chan struct{}
+	forwarders     sync.WaitGroup
+	failedAdapters map[string]bool
+	quit           chan struct{}
+	stopOnce       sync.Once
+	done           chan struct{}
+	errCh          chan error
+	stats          stats
+	sequencer      sequencer
+	conversations  conversations
+	groups         groups
+	limiters       limiters
+	triggers       triggers
+	openedDialogs  openedDialogs
+	users          users
 }
 
 type workerJob struct {
-	handler Handler
 	message *message.InMessage
+	tickets map[int]*ticket   // tickets of serialized handlers by handler index
+	turn    *conversationTurn // conversation that continues with the message
+	notice  bool              // reply the cooldown notice instead of handling
 }
 
-const (
-	numJobWorkers = 4
-	numJobBuffers = 20
-)
-
 // NewRobot creates new bot with specified adapter.
 func NewRobot(config *Config, client adapter.Adapter, logger *log.Logger) *Robot {
 	if logger == nil {
@@ -48,6 +73,7 @@ func NewRobot(config *Config, client adapter.Adapter, logger *log.Logger) *Robot
 		Config: config,
 		Client: client,
 		Logger: logger,
+		Brain:  brain.NewMemory(),
 	}
 
 	return bot
@@ -56,25 +82,35 @@ func NewRobot(config *Config, client adapter.Adapter, logger *log.Logger) *Robot
 // Start starts the bot process.
 func (r *Robot) Start() chan error {
 	r.errCh = make(chan error, 1)
+	r.quit = make(chan struct{})
+	r.done = make(chan struct{})
+	r.stopOnce = sync.Once{}
 	go r.run()
 	return r.errCh
 }
 
 func (r *Robot) run() {
-	r.aborted = false
-	r.quit = make(chan struct{}, 1)
-
-	r.workerJobs = make(chan workerJob, numJobBuffers)
-	for i := 1; i <= numJobWorkers; i++ {
+	r.ctx, r.cancel = context.WithCancel(context.Background())
+	r.workerJobs = make(chan workerJob, r.Config.queueSize())
+	for i := 1; i <= r.Config.workers(); i++ {
+		r.workers.Add(1)
 		go r.worker(i, r.workerJobs)
 	}
 
-	r.runLoop()
+	receiver := r.runLoop()
+	r.shutdown(receiver)
 
-	if !r.aborted {
-		r.Client.Stop()
-		r.Logger.Println("Stop adapter")
-	}
+	close(r.done)
+	close(r.errCh)
+}
+
+// shutdown stops the bot in order:
+// stop accepting webhooks, stop the scheduler, drain queued messages,
+// wait for running handlers and jobs, end conversations, and then stop the adapters.
+func (r *Robot) shutdown(receiver chan message.InMessage) {
+	timeout := r.Config.shutdownTimeout()
+
+	r.stopServer(receiver)
 
 	if r.scheduler != nil {
 		r.scheduler.Stop()
@@ -82,50 +118,90 @@ func (r *Robot) run() {
 	}
 
 	close(r.workerJobs)
-	close(r.quit)
-	close(r.errCh)
+	if waitTimeout(&r.workers, r.Config.drainTimeout()) {
+		r.Logger.Println("Stop workers")
+	} else {
+		r.Logger.Printf("Workers did not finish within %s; cancel running handlers", r.Config.drainTimeout())
+	}
+	r.cancel()
+	if !waitTimeout(&r.workers, timeout) {
+		r.Logger.Printf("Handlers did not finish within %s", timeout)
+	}
+	r.stopConversations()
+
+	if !waitTimeout(&r.runningJobs, timeout) {
+		r.Logger.Printf("Jobs did not finish within %s", timeout)
+	}
+
+	r.stopAdapters(timeout)
 }
 
-func (r *Robot) runLoop() {
+// runLoop receives messages until the bot stops.
+// A failed adapter is logged and the others keep running; the bot stops when all adapters have failed.
+func (r *Robot) runLoop() chan message.InMessage {
 	if !r.Config.DisableServer {
+		r.server = r.newServer()
 		go r.startServer()
 	}
 
-	receiver, errCh := r.Client.Start()
+	receiver, events := r.startAdapters()
 
 	r.startScheduler()
 
 	for {
 		select {
 		case <-r.quit:
-			return
-		case e, ok := <-errCh:
-			if ok {
-				r.aborted = true
-				r.Logger.Print(e)
+			return receiver
+		case ev := <-events:
+			r.failedAdapters[ev.name] = true
+			if ev.err != nil {
+				r.Logger.Printf("Adapter %q: %v", ev.name, ev.err)
+			} else {
+				r.Logger.Printf("Adapter %q closed", ev.name)
 			}
-			return
-		case msg, ok := <-receiver:
-			if !ok {
-				r.aborted = true
-				return
+			if len(r.failedAdapters) == len(r.allAdapters()) {
+				r.Logger.Println("All adapters have failed")
+				return receiver
 			}
+		case msg := <-receiver:
 			r.handle(&msg)
 		}
 	}
 }
 
-// Stop stops the bot.
+// Stop stops the bot and waits until the shutdown finishes.
 func (r *Robot) Stop() {
-	if !r.aborted {
-		r.quit <- struct{}{}
-		<-r.quit
-	}
+	r.stopOnce.Do(func() {
+		close(r.quit)
+	})
+	<-r.done
+}
+
+// Done returns a channel that is closed when the bot has been shut down.
+func (r *Robot) Done() <-chan struct{} {
+	return r.done
 }
 
 // Send sends a message to the chat service.
+// The message is sent through the adapter of OutMessage.Adapter, or the adapter
+// that the replied or triggering message came from (default: Robot.Client).
 func (r *Robot) Send(msg *message.OutMessage) error {
-	return r.Client.Send(msg)
+	a, err := r.Adapter(outAdapterName(msg))
+	if err != nil {
+		return err
+	}
+
+	r.prepareActions(msg)
+	return a.Send(msg)
+}
+
+// Now returns the current time of Robot.Clock.
+// Jobs should use it instead of time.Now so that they can be tested with a frozen time.
+func (r *Robot) Now() time.Time {
+	if r.Clock != nil {
+		return r.Clock()
+	}
+	return time.Now()
 }
 
 // SenderName returns the bot name.
@@ -134,38 +210,239 @@ func (r *Robot) SenderName() string {
 }
 
 func (r *Robot) handle(msg *message.InMessage) {
+	if job, ok := r.receive(msg); ok {
+		r.enqueue(job)
+	}
+}
+
+// Dispatch passes the message to the handlers and waits until they finish.
+// It bypasses the worker queue, so the bot does not need to be started.
+// It is intended for testing handlers.
+func (r *Robot) Dispatch(msg *message.InMessage) {
+	if job, ok := r.receive(msg); ok {
+		r.dispatch(job)
+	}
+}
+
+// receive makes the worker job for the received message.
+// It returns false if the message exceeds the user or channel limit and needs no cooldown notice.
+func (r *Robot) receive(msg *message.InMessage) (workerJob, bool) {
 	msg.Sender = r
+	atomic.AddUint64(&r.stats.received, 1)
+	r.rememberTrigger(msg)
+	r.rememberUser(msg)
 
-	for _, handler := range r.Handlers {
-		r.workerJobs <- workerJob{
-			handler: handler,
+	if allowed, notice := r.allowMessage(msg); !allowed {
+		return workerJob{
 			message: msg,
-		}
+			notice:  true,
+		}, notice
 	}
+
+	if turn := r.takeConversation(msg); turn != nil {
+		return workerJob{
+			message: msg,
+			turn:    turn,
+		}, true
+	}
+
+	return workerJob{
+		message: msg,
+		tickets: r.issueTickets(msg),
+	}, true
 }
 
 func (r *Robot) worker(id int, jobs <-chan workerJob) {
+	defer r.workers.Done()
 	for job := range jobs {
-		r.callHandler(job.handler, job.message)
+		r.dispatch(job)
 	}
 }
 
-func (r *Robot) callHandler(handler Handler, msg *message.InMessage) {
+// waitTimeout waits for the WaitGroup up to the timeout.
+// It returns false if the timeout expires.
+func waitTimeout(wg *sync.WaitGroup, timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// dispatch passes the message to the handlers in order of priority.
+// Handlers that have the same priority run one by one in order of Robot.Handlers
+// within the worker, and each of them receives its own copy of the message.
+// The built-in help command runs after the handlers of the default priority.
+// The fallback handler runs only if no handler can handle the message.
+// A message that continues a conversation goes only to the conversation.
+// A message that some handlers deny or limit is answered at most once.
+func (r *Robot) dispatch(job workerJob) {
+	defer releaseTickets(job.tickets)
 	defer func() {
-		if err := recover(); err != nil {
-			const size = 64 << 10
-			buf := make([]byte, size)
-			buf = buf[:runtime.Stack(buf, false)]
-			r.Logger.Printf("mmbot: panic handler: %v\n%s", err, buf)
+		// handlers are recovered by the middleware; this catches panics in CanHandle and the like
+		if e := recover(); e != nil {
+			r.Logger.Print(panicError(e))
 		}
 	}()
 
-	if handler.CanHandle(msg) {
-		err := handler.Handle(msg)
-		if err != nil {
-			r.Logger.Print(err)
+	msg := job.message
+	if job.notice {
+		r.notifyCooldown(msg)
+		return
+	}
+	if job.turn != nil {
+		r.continueConversation(job.turn, msg)
+		return
+	}
+
+	handlers := make([]indexedHandler, len(r.Handlers), len(r.Handlers)+1)
+	for i, handler := range r.Handlers {
+		handlers[i] = indexedHandler{index: i, handler: handler}
+	}
+	if help := r.helpHandler(); help != nil {
+		handlers = append(handlers, indexedHandler{index: helpIndex, handler: help})
+	}
+
+	var results callResults
+	for _, group := range groupHandlers(handlers) {
+		consumed := false
+		for _, ih := range group {
+			m := *msg
+			res := r.callHandler(ih.index, ih.handler, &m, job.tickets[ih.index])
+			results.add(res)
+			consumed = consumed || res == callConsumed
+		}
+		if consumed {
+			break
 		}
 	}
+
+	if !results.matched && r.Fallback != nil {
+		m := *msg
+		results.add(r.callHandler(fallbackIndex, r.Fallback, &m, job.tickets[fallbackIndex]))
+	}
+
+	if results.denied {
+		r.deny(msg)
+	} else if results.notice {
+		r.notifyCooldown(msg)
+	}
+}
+
+// callResult is the result of a handler call.
+type callResult int
+
+const (
+	callSkipped  callResult = iota // the handler cannot handle the message
+	callHandled                    // the handler handled the message
+	callConsumed                   // the handler handled the message and consumed it
+	callDenied                     // the message does not satisfy the permission of the handler
+	callLimited                    // the handler exceeded its limit
+	callCooldown                   // the handler exceeded its limit and the cooldown notice is needed
+)
+
+// callResults summarizes the results of the handler calls for a message.
+type callResults struct {
+	matched bool // any handler can handle the message
+	denied  bool
+	notice  bool
+}
+
+func (rs *callResults) add(res callResult) {
+	rs.matched = rs.matched || res != callSkipped
+	rs.denied = rs.denied || res == callDenied
+	rs.notice = rs.notice || res == callCooldown
+}
+
+// callHandler calls the handler if it can handle the message and the message
+// satisfies its permission and limit.
+// If the ticket is not nil, the handler waits for its turn before handling.
+// The handler receives a context that is canceled on timeout or shutdown.
+// Panics and errors of the handler are handled by the default middlewares.
+// Denied and limited messages are logged, and the caller answers them.
+func (r *Robot) callHandler(index int, handler Handler, msg *message.InMessage, t *ticket) callResult {
+	if t != nil {
+		defer t.release()
+	}
+
+	if !handler.CanHandle(msg) {
+		return callSkipped
+	}
+	if !r.permitted(handler, msg) {
+		r.logDenied(msg)
+		return callDenied
+	}
+	if allowed, notice := r.allowHandler(index, handler, msg); !allowed {
+		if notice {
+			return callCooldown
+		}
+		return callLimited
+	}
+	if t != nil {
+		t.wait()
+	}
+
+	ctx, cancel := r.handlerContext(handler)
+	defer cancel()
+
+	err := r.applyMiddlewares(AdaptHandler(handler).HandleContext)(ctx, msg)
+	if err == ErrConsumed {
+		return callConsumed
+	}
+	return callHandled
+}
+
+func (r *Robot) handlerContext(handler Handler) (context.Context, context.CancelFunc) {
+	parent := r.ctx
+	if parent == nil {
+		parent = context.Background()
+	}
+
+	timeout := r.Config.HandlerTimeout
+	if h, ok := handler.(TimeoutHandler); ok && h.HandlerTimeout() != 0 {
+		timeout = h.HandlerTimeout()
+	}
+	if timeout > 0 {
+		return context.WithTimeout(parent, timeout)
+	}
+	return context.WithCancel(parent)
+}
+
+type indexedHandler struct {
+	index   int // index in Robot.Handlers
+	handler Handler
+}
+
+// groupHandlers groups the handlers by priority in descending order.
+func groupHandlers(handlers []indexedHandler) [][]indexedHandler {
+	sorted := make([]indexedHandler, len(handlers))
+	copy(sorted, handlers)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return handlerPriority(sorted[i].handler) > handlerPriority(sorted[j].handler)
+	})
+
+	var groups [][]indexedHandler
+	for i, ih := range sorted {
+		if i == 0 || handlerPriority(ih.handler) != handlerPriority(sorted[i-1].handler) {
+			groups = append(groups, nil)
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], ih)
+	}
+	return groups
+}
+
+func handlerPriority(handler Handler) int {
+	if h, ok := handler.(PriorityHandler); ok {
+		return h.HandlerPriority()
+	}
+	return 0
 }
 
 func (r *Robot) startScheduler() {
@@ -175,7 +452,10 @@ func (r *Robot) startScheduler() {
 
 	r.scheduler = cron.New()
 	for _, job := range r.Jobs {
+		job := job
 		r.scheduler.AddFunc(job.Schedule, func() {
+			r.runningJobs.Add(1)
+			defer r.runningJobs.Done()
 			job.Action(r)
 		})
 	}
@@ -183,35 +463,84 @@ func (r *Robot) startScheduler() {
 	r.Logger.Println("Start job scheduler")
 }
 
-func (r *Robot) startServer() {
+func (r *Robot) newServer() *http.Server {
 	mux := mux.NewRouter()
 	r.mountRoutes(mux)
+	r.mountActions(mux)
+	r.mountDialogs(mux)
 	r.mountClient(mux)
 
-	r.Logger.Printf("Listening on %s\n", r.Config.Address())
-	server := &http.Server{
+	return &http.Server{
 		Addr:        r.Config.Address(),
 		Handler:     mux,
 		ReadTimeout: 30 * time.Second,
 		ErrorLog:    r.Logger,
 	}
-	if err := server.ListenAndServe(); err != nil {
+}
+
+func (r *Robot) startServer() {
+	r.Logger.Printf("Listening on %s\n", r.Config.Address())
+	if err := r.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		r.errCh <- err
+		r.stopOnce.Do(func() {
+			close(r.quit)
+		})
 	}
-	r.Stop()
 }
 
-func (r *Robot) mountClient(mux *mux.Router) {
-	hook := r.Client.IncomingWebHook()
-	if hook == nil {
+// stopServer shuts down the HTTP server gracefully.
+// Messages from the receiver are still handled until the server stops
+// so that running webhook requests can finish.
+func (r *Robot) stopServer(receiver chan message.InMessage) {
+	if r.server == nil {
 		return
 	}
 
-	path := hook.Path
-	if path == "" {
-		path = "/"
+	stopped := make(chan struct{})
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), r.Config.shutdownTimeout())
+		defer cancel()
+		if err := r.server.Shutdown(ctx); err != nil {
+			r.Logger.Printf("HTTP server shutdown: %v", err)
+		}
+		close(stopped)
+	}()
+
+	for {
+		select {
+		case <-stopped:
+			r.Logger.Println("Stop HTTP server")
+			return
+		case msg, ok := <-receiver:
+			if !ok {
+				receiver = nil
+				continue
+			}
+			r.handle(&msg)
+		}
+	}
+}
+
+// mountClient mounts the webhooks of the adapters.
+// Each adapter must have a different path.
+func (r *Robot) mountClient(mux *mux.Router) {
+	adapters := r.allAdapters()
+	for _, name := range r.adapterNames() {
+		client := adapters[name]
+		if hook := client.IncomingWebHook(); hook != nil {
+			path := hook.Path
+			if path == "" {
+				path = "/"
+			}
+			mux.Handle(path, hook.Handler)
+		}
+
+		if client, ok := client.(adapter.SlashCommandAdapter); ok {
+			if hook := client.SlashCommandHook(); hook != nil {
+				mux.Handle(hook.Path, hook.Handler)
+			}
+		}
 	}
-	mux.Handle(path, hook.Handler)
 }
 
 func (r *Robot) mountRoutes(mux *mux.Router) {
@@ -1,6 +1,7 @@
 package mmbot
 
 import (
+	"encoding/json"
 	"net/http"
 
 	"github.com/fukata/golang-stats-api-handler"
@@ -35,6 +36,18 @@ func NewPingRoute(pattern string) Route {
 	}
 }
 
+// NewRobotStatsRoute returns the route for statistics of message dispatching in JSON.
+func NewRobotStatsRoute(pattern string) Route {
+	return Route{
+		Methods: []string{"GET"},
+		Pattern: pattern,
+		Action: func(bot *Robot, w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(bot.Stats())
+		},
+	}
+}
+
 // NewStatsRoute returns the route for statistics of the process.
 func NewStatsRoute(pattern string) Route {
 	return Route{
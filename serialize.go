@@ -0,0 +1,173 @@
+package mmbot
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/yukithm/mmbot/message"
+)
+
+// DispatchMode decides how calls of a handler are serialized.
+type DispatchMode int
+
+const (
+	// DispatchConcurrent calls the handler concurrently (default).
+	DispatchConcurrent DispatchMode = iota
+
+	// DispatchSerialHandler calls the handler one at a time in order of receipt.
+	DispatchSerialHandler
+
+	// DispatchSerialChannel calls the handler one at a time per channel in order of receipt.
+	DispatchSerialChannel
+
+	// DispatchSerialUser calls the handler one at a time per user in order of receipt.
+	DispatchSerialUser
+)
+
+// SerialHandler is a handler that has a dispatch mode.
+// Only messages the handler can handle wait for their turn.
+type SerialHandler interface {
+	Handler
+	HandlerDispatchMode() DispatchMode
+}
+
+func handlerDispatchMode(handler Handler) DispatchMode {
+	if h, ok := handler.(SerialHandler); ok {
+		return h.HandlerDispatchMode()
+	}
+	return DispatchConcurrent
+}
+
+// fallbackIndex is the handler index of Robot.Fallback for tickets.
+const fallbackIndex = -1
+
+// conversationIndex is the handler index of conversation turns.
+// They are not limited by handler limits.
+const conversationIndex = -2
+
+// helpIndex is the handler index of the built-in help command.
+const helpIndex = -3
+
+// issueTickets issues tickets for the serialized handlers.
+// It must be called in order of receipt.
+func (r *Robot) issueTickets(msg *message.InMessage) map[int]*ticket {
+	var tickets map[int]*ticket
+	issue := func(index int, handler Handler) {
+		key := serialKey(index, handlerDispatchMode(handler), msg)
+		if key == "" {
+			return
+		}
+		if tickets == nil {
+			tickets = make(map[int]*ticket)
+		}
+		tickets[index] = r.sequencer.issue(key)
+	}
+
+	for i, handler := range r.Handlers {
+		issue(i, handler)
+	}
+	if r.Fallback != nil {
+		issue(fallbackIndex, r.Fallback)
+	}
+
+	return tickets
+}
+
+func releaseTickets(tickets map[int]*ticket) {
+	for _, t := range tickets {
+		t.release()
+	}
+}
+
+func serialKey(index int, mode DispatchMode, msg *message.InMessage) string {
+	switch mode {
+	case DispatchSerialHandler:
+		return fmt.Sprintf("%d", index)
+	case DispatchSerialChannel:
+		return fmt.Sprintf("%d:channel:%s", index, messageChannel(msg))
+	case DispatchSerialUser:
+		return fmt.Sprintf("%d:user:%s", index, messageUser(msg))
+	default:
+		return ""
+	}
+}
+
+// sequencer issues numbered tickets per key and serves them in order.
+type sequencer struct {
+	mu        sync.Mutex
+	sequences map[string]*sequence
+}
+
+type sequence struct {
+	next    uint64          // number of the next ticket to issue
+	serving uint64          // number of the ticket being served
+	done    map[uint64]bool // tickets released before their turn
+	changed chan struct{}   // closed when serving changes
+}
+
+type ticket struct {
+	s    *sequencer
+	key  string
+	seq  *sequence // kept even after the sequence is removed from s
+	num  uint64
+	once sync.Once
+}
+
+func (s *sequencer) issue(key string) *ticket {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.sequences == nil {
+		s.sequences = make(map[string]*sequence)
+	}
+	seq, ok := s.sequences[key]
+	if !ok {
+		seq = &sequence{
+			done:    make(map[uint64]bool),
+			changed: make(chan struct{}),
+		}
+		s.sequences[key] = seq
+	}
+
+	t := &ticket{s: s, key: key, seq: seq, num: seq.next}
+	seq.next++
+	return t
+}
+
+// wait blocks until the turn of the ticket comes.
+// It returns immediately if the ticket has been released.
+func (t *ticket) wait() {
+	for {
+		t.s.mu.Lock()
+		seq := t.seq
+		if seq.serving >= t.num {
+			t.s.mu.Unlock()
+			return
+		}
+		changed := seq.changed
+		t.s.mu.Unlock()
+		<-changed
+	}
+}
+
+// release finishes the ticket. It can be called before the turn of the ticket
+// comes, and calling it more than once is a no-op.
+func (t *ticket) release() {
+	t.once.Do(func() {
+		t.s.mu.Lock()
+		defer t.s.mu.Unlock()
+
+		seq := t.seq
+		seq.done[t.num] = true
+		for seq.done[seq.serving] {
+			delete(seq.done, seq.serving)
+			seq.serving++
+		}
+		close(seq.changed)
+		seq.changed = make(chan struct{})
+
+		if seq.serving == seq.next && t.s.sequences[t.key] == seq {
+			delete(t.s.sequences, t.key)
+		}
+	})
+}
@@ -0,0 +1,122 @@
+package mmbot
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yukithm/mmbot/message"
+)
+
+// waitTurn waits for the turn of the ticket, or returns false after a while.
+func waitTurn(t *ticket) bool {
+	done := make(chan struct{})
+	go func() {
+		t.wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(100 * time.Millisecond):
+		return false
+	}
+}
+
+func TestSequencerOrder(t *testing.T) {
+	var s sequencer
+	tickets := make([]*ticket, 5)
+	for i := range tickets {
+		tickets[i] = s.issue("key")
+	}
+
+	var mu sync.Mutex
+	var order []uint64
+	var wg sync.WaitGroup
+	for i := len(tickets) - 1; i >= 0; i-- {
+		wg.Add(1)
+		go func(t *ticket) {
+			defer wg.Done()
+			t.wait()
+			mu.Lock()
+			order = append(order, t.num)
+			mu.Unlock()
+			t.release()
+		}(tickets[i])
+	}
+	wg.Wait()
+
+	for i, num := range order {
+		if num != uint64(i) {
+			t.Fatalf("served in %v, want in order of issue", order)
+		}
+	}
+	if len(s.sequences) != 0 {
+		t.Errorf("%d sequences left after all tickets are released", len(s.sequences))
+	}
+}
+
+func TestSequencerReleaseBeforeTurn(t *testing.T) {
+	var s sequencer
+	t0, t1, t2, t3 := s.issue("key"), s.issue("key"), s.issue("key"), s.issue("key")
+	other := s.issue("other")
+
+	if !waitTurn(other) {
+		t.Error("ticket of another key waits")
+	}
+
+	// t1 and t2 give up before their turn, e.g. the handler cannot handle the message
+	t2.release()
+	t1.release()
+	t1.release()
+	if waitTurn(t3) {
+		t.Fatal("t3 is served before t0 is released")
+	}
+
+	t0.release()
+	if !waitTurn(t3) {
+		t.Fatal("t3 is not served after the earlier tickets are released")
+	}
+	t3.release()
+	other.release()
+	if !waitTurn(t1) {
+		t.Error("released ticket waits")
+	}
+
+	if len(s.sequences) != 0 {
+		t.Errorf("%d sequences left after all tickets are released", len(s.sequences))
+	}
+
+	// a new sequence starts after the old one is removed
+	next := s.issue("key")
+	if !waitTurn(next) {
+		t.Error("first ticket of the new sequence waits")
+	}
+	next.release()
+}
+
+func TestSerialKey(t *testing.T) {
+	msg := &message.InMessage{
+		Adapter:     "second",
+		ChannelID:   "c1",
+		ChannelName: "town-square",
+		UserID:      "u1",
+		UserName:    "alice",
+	}
+
+	tests := []struct {
+		mode DispatchMode
+		want string
+	}{
+		{DispatchConcurrent, ""},
+		{DispatchSerialHandler, "3"},
+		{DispatchSerialChannel, "3:channel:second/c1"},
+		{DispatchSerialUser, "3:user:second/u1"},
+	}
+	for _, tt := range tests {
+		if got := serialKey(3, tt.mode, msg); got != tt.want {
+			t.Errorf("serialKey(%v) = %q, want %q", tt.mode, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package shell
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yukithm/mmbot/message"
+)
+
+// DefaultSettleTime is the time to wait for the bot to stop sending messages
+// after each line in batch mode.
+const DefaultSettleTime = 200 * time.Millisecond
+
+// Dispatcher passes a message to the handlers and waits until they finish.
+// mmbot.Robot implements it.
+type Dispatcher interface {
+	Dispatch(msg *message.InMessage)
+}
+
+// RunBatch reads the script and dispatches its messages one by one without the interactive shell.
+// After each message, it waits until the bot sends no message for settle.
+// The transcript of received and sent messages is written to out in c.Format.
+//
+// Each line of the script is a message, a meta command such as "/user alice",
+// or a slash command. A message line can start with metadata in brackets,
+// which applies only to the line:
+//
+//	[alice #town-square] hello   message from alice in town-square
+//	[@bob] hello                 direct message from bob
+//
+// Empty lines and lines starting with "#" are ignored.
+//
+// Handlers of the same priority run one by one in order, so the transcript is
+// stable as long as the handlers do not send messages from their own goroutines
+// or take longer than settle. Jobs are not run in batch mode.
+func (c *Client) RunBatch(script io.Reader, d Dispatcher, out io.Writer, settle time.Duration) error {
+	if settle <= 0 {
+		settle = DefaultSettleTime
+	}
+	c.out = out
+	c.info = ioutil.Discard
+	defer func() {
+		c.out = nil
+		c.info = nil
+	}()
+
+	scanner := bufio.NewScanner(script)
+	lineno := 0
+	for scanner.Scan() {
+		lineno++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		msg, err := c.parseScriptLine(line)
+		if err != nil {
+			return fmt.Errorf("line %d: %v", lineno, err)
+		}
+		if msg == nil {
+			continue
+		}
+
+		c.seq++
+		msg.PostID = "post" + strconv.Itoa(c.seq)
+		if c.Verbose {
+			if err := c.dump("Receive", msg); err != nil {
+				return err
+			}
+		}
+		if err := c.writeReceived(msg); err != nil {
+			return err
+		}
+		d.Dispatch(msg)
+		c.waitIdle(settle)
+	}
+	return scanner.Err()
+}
+
+// parseScriptLine parses a script line with optional metadata.
+func (c *Client) parseScriptLine(line string) (*message.InMessage, error) {
+	if !strings.HasPrefix(line, "[") {
+		return c.parseLine(line)
+	}
+
+	end := strings.Index(line, "]")
+	if end < 0 {
+		return nil, fmt.Errorf("Unclosed metadata: %q", line)
+	}
+
+	user, channel := c.userName, c.channelName
+	for _, field := range strings.Fields(line[1:end]) {
+		switch {
+		case strings.HasPrefix(field, "#"), strings.HasPrefix(field, "~"):
+			channel = field[1:]
+		case strings.HasPrefix(field, "@"):
+			user = field[1:]
+			channel = field
+		default:
+			user = field
+		}
+	}
+
+	// metadata applies only to the line
+	origUser, origChannel := c.userName, c.channelName
+	c.userName, c.channelName = user, channel
+	defer func() {
+		c.userName, c.channelName = origUser, origChannel
+	}()
+
+	return c.parseLine(strings.TrimSpace(line[end+1:]))
+}
+
+// waitIdle waits until no message has been sent for settle.
+func (c *Client) waitIdle(settle time.Duration) {
+	for {
+		c.mu.Lock()
+		idle := time.Since(c.lastActivity)
+		c.mu.Unlock()
+
+		if idle >= settle {
+			return
+		}
+		time.Sleep(settle - idle)
+	}
+}
@@ -0,0 +1,157 @@
+package shell_test
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yukithm/mmbot"
+	"github.com/yukithm/mmbot/adapter"
+	"github.com/yukithm/mmbot/message"
+	"github.com/yukithm/mmbot/shell"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func newTestRobot(client *shell.Client) *mmbot.Robot {
+	robot := mmbot.NewRobot(&mmbot.Config{
+		UserName:      "mmbot",
+		DisableServer: true,
+	}, client, nil)
+	robot.Handlers = []mmbot.Handler{
+		mmbot.PatternHandler{
+			Pattern: regexp.MustCompile(`\Ahello`),
+			Action: func(msg *message.InMessage) error {
+				return msg.Reply("Hello, " + msg.UserName)
+			},
+		},
+		// handlers with the same priority reply in order
+		mmbot.PatternHandler{
+			MessageType: message.MentionMessage | message.DirectMessage,
+			Pattern:     regexp.MustCompile(`\bping\z`),
+			Action: func(msg *message.InMessage) error {
+				return msg.Reply("pong")
+			},
+		},
+		mmbot.PatternHandler{
+			MessageType: message.MentionMessage | message.DirectMessage,
+			Pattern:     regexp.MustCompile(`\bping\z`),
+			Action: func(msg *message.InMessage) error {
+				return msg.Reply("pong again")
+			},
+		},
+		mmbot.CommandHandler{
+			Commands: []mmbot.Command{
+				{
+					Name: "echo",
+					Args: []mmbot.CommandArg{{Name: "text", Variadic: true}},
+					Action: func(msg *message.InMessage) error {
+						return msg.Reply(msg.Args.String("text"))
+					},
+				},
+			},
+		},
+		// a markdown report for the markdown format
+		mmbot.PatternHandler{
+			Pattern: regexp.MustCompile(`\Areport\z`),
+			Action: func(msg *message.InMessage) error {
+				return msg.Sender.Send(&message.OutMessage{
+					ChannelName: msg.ChannelName,
+					InReplyTo:   msg,
+					Text:        reportText,
+					Attachments: []*message.Attachment{
+						{
+							Color: "good",
+							Title: "Build #42",
+							Text:  "**passed** in `3m`",
+							Fields: []*message.AttachmentField{
+								{Title: "Branch", Value: "master", Short: true},
+								{Title: "Commit", Value: "`4709bcc`", Short: true},
+								{Title: "Changes", Value: "- fix the race\n- add tests"},
+							},
+							Footer: "ci",
+						},
+					},
+				})
+			},
+		},
+	}
+	robot.Fallback = mmbot.PatternHandler{
+		MessageType: message.MentionMessage | message.DirectMessage,
+		Pattern:     regexp.MustCompile(`.*`),
+		Action: func(msg *message.InMessage) error {
+			return msg.Reply("Sorry, I don't understand.")
+		},
+	}
+	return robot
+}
+
+const reportText = `# Report
+| Job | Status | Time |
+|:----|:------:|-----:|
+| build | **ok** | 3m |
+| test | ~~ng~~ ok | 12m |
+
+` + "```go" + `
+fmt.Println("*not emphasis*")
+` + "```"
+
+func TestRunBatch(t *testing.T) {
+	for _, format := range []shell.Format{shell.FormatHuman, shell.FormatJSONL, shell.FormatMarkdown} {
+		script, err := os.Open(filepath.Join("testdata", "batch.script"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		client := shell.NewClient(&adapter.Config{}, nil)
+		client.Format = format
+		var buf bytes.Buffer
+		err = client.RunBatch(script, newTestRobot(client), &buf, 10*time.Millisecond)
+		script.Close()
+		if err != nil {
+			t.Fatalf("%s: RunBatch() failed: %v", format, err)
+		}
+
+		golden := filepath.Join("testdata", "batch."+format.String()+".golden")
+		if *update {
+			if err := ioutil.WriteFile(golden, buf.Bytes(), 0644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+
+		want, err := ioutil.ReadFile(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := shell.Diff(string(want), buf.String()); diff != "" {
+			t.Errorf("%s: transcript differs from %s:\n%s", format, golden, diff)
+		}
+	}
+}
+
+func TestRunBatchInvalidScript(t *testing.T) {
+	client := shell.NewClient(&adapter.Config{}, nil)
+	script := strings.NewReader("hello\n[alice hello\n")
+	err := client.RunBatch(script, newTestRobot(client), ioutil.Discard, time.Millisecond)
+	if err == nil || !strings.HasPrefix(err.Error(), "line 2:") {
+		t.Errorf("error = %v, want an error at line 2", err)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	if diff := shell.Diff("a\nb\n", "a\nb\n"); diff != "" {
+		t.Errorf("Diff() of the same text = %q, want empty", diff)
+	}
+
+	want := " a\n-b\n+c\n \n"
+	if diff := shell.Diff("a\nb\n", "a\nc\n"); diff != want {
+		t.Errorf("Diff() = %q, want %q", diff, want)
+	}
+}
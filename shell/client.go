@@ -7,8 +7,9 @@ import (
 	"io"
 	"io/ioutil"
 	"log"
-	"strconv"
+	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"gopkg.in/readline.v1"
@@ -20,12 +21,23 @@ import (
 
 // Client is a client for the shell.
 type Client struct {
-	config   *adapter.Config
-	logger   *log.Logger
-	in       chan message.InMessage
-	quit     chan struct{}
-	quitting bool
-	errCh    chan error
+	Format  Format // output format (default: FormatHuman)
+	Verbose bool   // dump raw messages as JSON
+
+	config      *adapter.Config
+	logger      *log.Logger
+	in          chan message.InMessage
+	quit        chan struct{}
+	quitting    bool
+	errCh       chan error
+	userName    string // simulated sender
+	channelName string // simulated channel (starts with "@" for direct messages)
+
+	mu           sync.Mutex
+	out          io.Writer // output of messages (default: stdout)
+	info         io.Writer // output of meta commands (default: stdout)
+	lastActivity time.Time
+	seq          int
 }
 
 // NewClient returns new shell client.
@@ -34,8 +46,10 @@ func NewClient(config *adapter.Config, logger *log.Logger) *Client {
 		logger = log.New(ioutil.Discard, "", 0)
 	}
 	c := &Client{
-		config: config,
-		logger: logger,
+		config:      config,
+		logger:      logger,
+		userName:    DefaultUserName,
+		channelName: DefaultChannelName,
 	}
 
 	return c
@@ -76,14 +90,12 @@ func (c *Client) Send(msg *message.OutMessage) error {
 		om.IconURL = c.config.IconURL
 	}
 
-	buf, err := toJSON(om)
-	if err != nil {
-		return err
+	if c.Verbose {
+		if err := c.dump("Send", om); err != nil {
+			return err
+		}
 	}
-	fmt.Printf("[Send]\n%s\n----------------\n", buf)
-	fmt.Printf("mmbot> %s\n", om.Text)
-
-	return nil
+	return c.writeSent(om, msg.Ephemeral)
 }
 
 // IncomingWebHook returns webhook. It will be disabled if nil.
@@ -92,7 +104,10 @@ func (c *Client) IncomingWebHook() *adapter.IncomingWebHook {
 }
 
 func (c *Client) readline() {
-	rl, err := NewReadline("shell> ")
+	rl, err := NewReadlineEx(&readline.Config{
+		Prompt:       "shell> ",
+		AutoComplete: newCompleter(),
+	})
 	if err != nil {
 		c.errCh <- err
 		return
@@ -114,30 +129,88 @@ func (c *Client) readline() {
 			continue
 		}
 
-		msg := translateInMessage(&mmhook.InMessage{
-			ChannelID:   "shell",
-			ChannelName: "shell",
-			TeamDomain:  "shell",
-			TeamID:      "shell",
-			Text:        line,
-			Timestamp:   strconv.FormatInt(time.Now().Unix(), 10),
-			Token:       "shell_token",
-			TriggerWord: strings.Fields(line)[0],
-			UserID:      "shell",
-			UserName:    "shell",
-		})
-
-		buf, err := toJSON(msg)
+		msg, err := c.parseLine(line)
 		if err != nil {
-			c.errCh <- err
-			return
+			fmt.Println(err)
+			continue
+		}
+		if msg == nil {
+			continue
+		}
+
+		if c.Verbose {
+			if err := c.dump("Receive", msg); err != nil {
+				c.errCh <- err
+				return
+			}
 		}
-		fmt.Printf("[Receive]\n%s\n----------------\n", buf)
 
 		c.in <- *msg
 	}
 }
 
+func (c *Client) writeReceived(msg *message.InMessage) error {
+	return c.writeEntry(&entry{
+		Direction: directionReceived,
+		Channel:   msg.ChannelName,
+		User:      msg.UserName,
+		PostID:    msg.PostID,
+		RootID:    msg.RootID,
+		Text:      msg.Text,
+	})
+}
+
+func (c *Client) writeSent(om *mmhook.OutMessage, ephemeral bool) error {
+	user := om.UserName
+	if user == "" {
+		user = "mmbot"
+	}
+	return c.writeEntry(&entry{
+		Direction:   directionSent,
+		Channel:     om.Channel,
+		User:        user,
+		RootID:      om.RootID,
+		Text:        om.Text,
+		Attachments: om.Attachments,
+		Ephemeral:   ephemeral,
+	})
+}
+
+func (c *Client) writeEntry(e *entry) error {
+	s, err := e.format(c.Format)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lastActivity = time.Now()
+	_, err = io.WriteString(c.output(), s)
+	return err
+}
+
+// dump writes the raw message as JSON.
+func (c *Client) dump(label string, obj interface{}) error {
+	buf, err := toJSON(obj)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, err = fmt.Fprintf(c.output(), "[%s]\n%s\n----------------\n", label, buf)
+	return err
+}
+
+func (c *Client) output() io.Writer {
+	if c.out == nil {
+		return os.Stdout
+	}
+	return c.out
+}
+
 func toJSON(obj interface{}) ([]byte, error) {
 	return json.MarshalIndent(obj, "", "    ")
 }
@@ -0,0 +1,53 @@
+package shell
+
+import (
+	"bytes"
+	"strings"
+)
+
+// Diff returns the line differences from want to got.
+// Removed lines start with "-", added lines start with "+" and common lines start with " ".
+// It returns an empty string if they are the same.
+func Diff(want, got string) string {
+	if want == got {
+		return ""
+	}
+
+	a := strings.Split(want, "\n")
+	b := strings.Split(got, "\n")
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			buf.WriteString(" " + a[i] + "\n")
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			buf.WriteString("-" + a[i] + "\n")
+			i++
+		default:
+			buf.WriteString("+" + b[j] + "\n")
+			j++
+		}
+	}
+	return buf.String()
+}
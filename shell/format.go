@@ -0,0 +1,128 @@
+package shell
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/yukithm/mmbot/message"
+)
+
+// Format is an output format of the shell.
+type Format int
+
+const (
+	// FormatHuman shows messages as compact text such as "[town-square] mmbot> hello".
+	FormatHuman Format = iota
+
+	// FormatJSONL shows each message as a line of JSON.
+	FormatJSONL
+
+	// FormatMarkdown renders the markdown of messages and attachments for terminals.
+	FormatMarkdown
+)
+
+var formatNames = map[Format]string{
+	FormatHuman:    "human",
+	FormatJSONL:    "jsonl",
+	FormatMarkdown: "markdown",
+}
+
+func (f Format) String() string {
+	if name, ok := formatNames[f]; ok {
+		return name
+	}
+	return fmt.Sprintf("Format(%d)", int(f))
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler interface.
+// It accepts "human", "jsonl" and "markdown".
+func (f *Format) UnmarshalText(text []byte) error {
+	name := strings.ToLower(string(text))
+	for format, n := range formatNames {
+		if n == name {
+			*f = format
+			return nil
+		}
+	}
+	return fmt.Errorf("Unknown output format: %q", text)
+}
+
+// Directions of entries.
+const (
+	directionReceived = "received"
+	directionSent     = "sent"
+)
+
+// entry is a received or sent message shown in the shell.
+type entry struct {
+	Direction   string                `json:"direction"` // "received" or "sent"
+	Channel     string                `json:"channel"`
+	User        string                `json:"user"`
+	PostID      string                `json:"post_id,omitempty"`
+	RootID      string                `json:"root_id,omitempty"`
+	Text        string                `json:"text"`
+	Attachments []*message.Attachment `json:"attachments,omitempty"`
+	Ephemeral   bool                  `json:"ephemeral,omitempty"`
+}
+
+// format returns the entry in the format.
+func (e *entry) format(f Format) (string, error) {
+	switch f {
+	case FormatJSONL:
+		buf, err := json.Marshal(e)
+		if err != nil {
+			return "", err
+		}
+		return string(buf) + "\n", nil
+	case FormatMarkdown:
+		return e.formatMarkdown(), nil
+	default:
+		return e.formatHuman(), nil
+	}
+}
+
+// formatHuman returns the entry such as "[town-square] alice> hello".
+func (e *entry) formatHuman() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s> ", e.header())
+
+	lines := strings.Split(e.Text, "\n")
+	buf.WriteString(lines[0] + "\n")
+	for _, line := range lines[1:] {
+		buf.WriteString("    " + line + "\n")
+	}
+	for _, a := range e.Attachments {
+		buf.WriteString(formatAttachment(a))
+	}
+	return buf.String()
+}
+
+// formatMarkdown returns the entry with the rendered text and attachment cards.
+func (e *entry) formatMarkdown() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s%s%s\n", ansiBold, e.header(), ansiNoBold)
+	if e.Text != "" {
+		for _, line := range renderMarkdown(e.Text) {
+			buf.WriteString("  " + line + "\n")
+		}
+	}
+	for _, a := range e.Attachments {
+		for _, line := range renderAttachment(a) {
+			buf.WriteString("  " + line + "\n")
+		}
+	}
+	return buf.String()
+}
+
+func (e *entry) header() string {
+	header := "[" + e.Channel + "] " + e.User
+	if e.RootID != "" {
+		header += " (thread)"
+	}
+	if e.Ephemeral {
+		header += " (only you)"
+	}
+	return header
+}
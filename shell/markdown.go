@@ -0,0 +1,338 @@
+package shell
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/yukithm/mmbot/message"
+)
+
+// ANSI escape sequences.
+const (
+	ansiBold         = "\x1b[1m"
+	ansiNoBold       = "\x1b[22m"
+	ansiDim          = "\x1b[2m"
+	ansiNoDim        = "\x1b[22m"
+	ansiItalic       = "\x1b[3m"
+	ansiNoItalic     = "\x1b[23m"
+	ansiUnderline    = "\x1b[4m"
+	ansiNoUnderline  = "\x1b[24m"
+	ansiStrike       = "\x1b[9m"
+	ansiNoStrike     = "\x1b[29m"
+	ansiCyan         = "\x1b[36m"
+	ansiDefaultColor = "\x1b[39m"
+)
+
+var (
+	ansiRegexp = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+
+	codeSpanRegexp    = regexp.MustCompile("`([^`]+)`")
+	linkRegexp        = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	boldStarRegexp    = regexp.MustCompile(`\*\*(.+?)\*\*`)
+	boldUnderRegexp   = regexp.MustCompile(`__(.+?)__`)
+	italicStarRegexp  = regexp.MustCompile(`\*([^*\s](?:[^*]*[^*\s])?)\*`)
+	italicUnderRegexp = regexp.MustCompile(`(^|[^\w])_([^_\s](?:[^_]*[^_\s])?)_([^\w]|$)`)
+	strikeRegexp      = regexp.MustCompile(`~~(.+?)~~`)
+
+	headingRegexp   = regexp.MustCompile(`^(#{1,6})\s+(.*)$`)
+	quoteRegexp     = regexp.MustCompile(`^>\s?(.*)$`)
+	listRegexp      = regexp.MustCompile(`^(\s*)[-*+]\s+(.*)$`)
+	ruleRegexp      = regexp.MustCompile(`^(?:-{3,}|\*{3,}|_{3,})$`)
+	tableRuleRegexp = regexp.MustCompile(`^\|?\s*:?-+:?\s*(?:\|\s*:?-+:?\s*)*\|?$`)
+)
+
+const ruleWidth = 40
+
+// renderMarkdown renders Mattermost flavored markdown for terminals.
+// It supports emphasis, code, links, headings, quotes, lists, rules, code blocks and tables.
+func renderMarkdown(text string) []string {
+	var out []string
+	lines := strings.Split(text, "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case strings.HasPrefix(trimmed, "```"):
+			lang := strings.TrimSpace(strings.TrimPrefix(trimmed, "```"))
+			if lang != "" {
+				out = append(out, ansiDim+lang+ansiNoDim)
+			}
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "```"); i++ {
+				out = append(out, ansiDim+"│ "+ansiNoDim+ansiCyan+lines[i]+ansiDefaultColor)
+			}
+		case strings.HasPrefix(trimmed, "|") && i+1 < len(lines) && tableRuleRegexp.MatchString(strings.TrimSpace(lines[i+1])):
+			rows := [][]string{splitTableRow(trimmed)}
+			aligns := tableAligns(strings.TrimSpace(lines[i+1]))
+			for i += 2; i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), "|"); i++ {
+				rows = append(rows, splitTableRow(strings.TrimSpace(lines[i])))
+			}
+			i--
+			out = append(out, renderTable(rows, aligns)...)
+		case headingRegexp.MatchString(trimmed):
+			m := headingRegexp.FindStringSubmatch(trimmed)
+			out = append(out, ansiBold+ansiUnderline+renderInline(m[2])+ansiNoUnderline+ansiNoBold)
+		case quoteRegexp.MatchString(trimmed):
+			m := quoteRegexp.FindStringSubmatch(trimmed)
+			out = append(out, ansiDim+"│ "+ansiNoDim+renderInline(m[1]))
+		case ruleRegexp.MatchString(trimmed):
+			out = append(out, ansiDim+strings.Repeat("─", ruleWidth)+ansiNoDim)
+		case listRegexp.MatchString(line):
+			m := listRegexp.FindStringSubmatch(line)
+			out = append(out, m[1]+"• "+renderInline(m[2]))
+		default:
+			out = append(out, renderInline(line))
+		}
+	}
+	return out
+}
+
+// renderInline renders inline markdown. Code spans are not rendered inside.
+func renderInline(text string) string {
+	var out string
+	last := 0
+	for _, loc := range codeSpanRegexp.FindAllStringSubmatchIndex(text, -1) {
+		out += renderEmphasis(text[last:loc[0]])
+		out += ansiCyan + text[loc[2]:loc[3]] + ansiDefaultColor
+		last = loc[1]
+	}
+	return out + renderEmphasis(text[last:])
+}
+
+func renderEmphasis(text string) string {
+	text = linkRegexp.ReplaceAllString(text, ansiUnderline+"${1}"+ansiNoUnderline+" <${2}>")
+	text = boldStarRegexp.ReplaceAllString(text, ansiBold+"${1}"+ansiNoBold)
+	text = boldUnderRegexp.ReplaceAllString(text, ansiBold+"${1}"+ansiNoBold)
+	text = italicStarRegexp.ReplaceAllString(text, ansiItalic+"${1}"+ansiNoItalic)
+	text = italicUnderRegexp.ReplaceAllString(text, "${1}"+ansiItalic+"${2}"+ansiNoItalic+"${3}")
+	text = strikeRegexp.ReplaceAllString(text, ansiStrike+"${1}"+ansiNoStrike)
+	return text
+}
+
+func splitTableRow(line string) []string {
+	line = strings.TrimPrefix(line, "|")
+	line = strings.TrimSuffix(line, "|")
+	cells := strings.Split(line, "|")
+	for i, cell := range cells {
+		cells[i] = renderInline(strings.TrimSpace(cell))
+	}
+	return cells
+}
+
+// Alignments of table columns.
+const (
+	alignLeft = iota
+	alignCenter
+	alignRight
+)
+
+func tableAligns(rule string) []int {
+	rule = strings.TrimPrefix(rule, "|")
+	rule = strings.TrimSuffix(rule, "|")
+	cols := strings.Split(rule, "|")
+	aligns := make([]int, len(cols))
+	for i, col := range cols {
+		col = strings.TrimSpace(col)
+		switch {
+		case strings.HasPrefix(col, ":") && strings.HasSuffix(col, ":"):
+			aligns[i] = alignCenter
+		case strings.HasSuffix(col, ":"):
+			aligns[i] = alignRight
+		}
+	}
+	return aligns
+}
+
+func renderTable(rows [][]string, aligns []int) []string {
+	var widths []int
+	for _, row := range rows {
+		for i, cell := range row {
+			if i >= len(widths) {
+				widths = append(widths, 0)
+			}
+			if w := displayWidth(cell); w > widths[i] {
+				widths[i] = w
+			}
+		}
+	}
+
+	var out []string
+	for r, row := range rows {
+		cells := make([]string, len(widths))
+		for i := range widths {
+			var cell string
+			if i < len(row) {
+				cell = row[i]
+			}
+			align := alignLeft
+			if i < len(aligns) {
+				align = aligns[i]
+			}
+			cells[i] = pad(cell, widths[i], align)
+			if r == 0 {
+				cells[i] = ansiBold + cells[i] + ansiNoBold
+			}
+		}
+		out = append(out, strings.Join(cells, " │ "))
+
+		if r == 0 {
+			rules := make([]string, len(widths))
+			for i, w := range widths {
+				rules[i] = strings.Repeat("─", w)
+			}
+			out = append(out, strings.Join(rules, "─┼─"))
+		}
+	}
+	return out
+}
+
+func pad(text string, width int, align int) string {
+	space := width - displayWidth(text)
+	if space <= 0 {
+		return text
+	}
+	switch align {
+	case alignRight:
+		return strings.Repeat(" ", space) + text
+	case alignCenter:
+		left := space / 2
+		return strings.Repeat(" ", left) + text + strings.Repeat(" ", space-left)
+	default:
+		return text + strings.Repeat(" ", space)
+	}
+}
+
+// displayWidth returns the width of the text on terminals.
+// Escape sequences are ignored, and East Asian wide characters count as two.
+func displayWidth(text string) int {
+	text = ansiRegexp.ReplaceAllString(text, "")
+	width := 0
+	for _, r := range text {
+		if isWide(r) {
+			width += 2
+		} else {
+			width++
+		}
+	}
+	return width
+}
+
+func isWide(r rune) bool {
+	return r >= 0x1100 && (r <= 0x115F ||
+		(r >= 0x2E80 && r <= 0xA4CF) ||
+		(r >= 0xAC00 && r <= 0xD7A3) ||
+		(r >= 0xF900 && r <= 0xFAFF) ||
+		(r >= 0xFE30 && r <= 0xFE4F) ||
+		(r >= 0xFF00 && r <= 0xFF60) ||
+		(r >= 0xFFE0 && r <= 0xFFE6) ||
+		(r >= 0x1F300 && r <= 0x1F64F))
+}
+
+// renderAttachment renders the attachment as a card with a colored left border.
+func renderAttachment(a *message.Attachment) []string {
+	var out []string
+	if a.Pretext != "" {
+		out = append(out, renderMarkdown(a.Pretext)...)
+	}
+
+	var body []string
+	if a.AuthorName != "" {
+		body = append(body, ansiDim+withLink(a.AuthorName, a.AuthorLink)+ansiNoDim)
+	}
+	if a.Title != "" {
+		body = append(body, ansiBold+withLink(a.Title, a.TitleLink)+ansiNoBold)
+	}
+	if a.Text != "" {
+		body = append(body, renderMarkdown(a.Text)...)
+	}
+	body = append(body, renderFields(a.Fields)...)
+	if a.ImageURL != "" {
+		body = append(body, "[image] "+a.ImageURL)
+	}
+	if a.ThumbURL != "" {
+		body = append(body, "[thumb] "+a.ThumbURL)
+	}
+	if len(a.Actions) > 0 {
+		body = append(body, formatActions(a.Actions))
+	}
+	if a.Footer != "" {
+		body = append(body, ansiDim+a.Footer+ansiNoDim)
+	}
+	if len(body) == 0 && a.Fallback != "" {
+		body = append(body, a.Fallback)
+	}
+
+	border := borderColor(a.Color) + "┃" + ansiDefaultColor + " "
+	for _, line := range body {
+		out = append(out, border+line)
+	}
+	return out
+}
+
+// renderFields renders the fields. Two consecutive short fields are shown side by side.
+func renderFields(fields []*message.AttachmentField) []string {
+	var out []string
+	for i := 0; i < len(fields); i++ {
+		f := fields[i]
+		title := ansiBold + renderInline(f.Title) + ansiNoBold
+		values := renderMarkdown(f.Value)
+		if f.Short && i+1 < len(fields) && fields[i+1].Short {
+			next := fields[i+1]
+			nextValues := renderMarkdown(next.Value)
+			left := []string{title}
+			left = append(left, values...)
+			right := []string{ansiBold + renderInline(next.Title) + ansiNoBold}
+			right = append(right, nextValues...)
+
+			width := 0
+			for _, line := range left {
+				if w := displayWidth(line); w > width {
+					width = w
+				}
+			}
+			for j := 0; j < len(left) || j < len(right); j++ {
+				var l, r string
+				if j < len(left) {
+					l = left[j]
+				}
+				if j < len(right) {
+					r = right[j]
+				}
+				out = append(out, strings.TrimRight(pad(l, width, alignLeft)+"    "+r, " "))
+			}
+			i++
+			continue
+		}
+
+		out = append(out, title)
+		out = append(out, values...)
+	}
+	return out
+}
+
+// borderColor returns the escape sequence of the attachment color.
+func borderColor(color string) string {
+	switch color {
+	case "good":
+		return "\x1b[32m"
+	case "warning":
+		return "\x1b[33m"
+	case "danger":
+		return "\x1b[31m"
+	}
+
+	hex := strings.TrimPrefix(color, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) != 6 {
+		return ansiDefaultColor
+	}
+	rgb, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return ansiDefaultColor
+	}
+	return fmt.Sprintf("\x1b[38;2;%d;%d;%dm", rgb>>16, rgb>>8&0xff, rgb&0xff)
+}
@@ -0,0 +1,244 @@
+package shell
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/readline.v1"
+
+	"github.com/yukithm/mmbot/message"
+	"github.com/yukithm/mmbot/mmhook"
+)
+
+// Default sender and channel of the shell.
+const (
+	DefaultUserName    = "shell"
+	DefaultChannelName = "shell"
+)
+
+// metaCommand is a shell command that is not sent to the bot.
+// Its action returns the message to send, or nil.
+type metaCommand struct {
+	name   string
+	usage  string
+	action func(c *Client, arg string) (*message.InMessage, error)
+}
+
+func metaCommands() []metaCommand {
+	return []metaCommand{
+		{"/user", "/user NAME          send the following lines as the user", (*Client).metaUser},
+		{"/channel", "/channel NAME       send the following lines to the channel", (*Client).metaChannel},
+		{"/dm", "/dm NAME            send the following lines as direct messages from the user", (*Client).metaDM},
+		{"/raw", "/raw {JSON}         send a message with the fields (see below)", (*Client).metaRaw},
+		{"/help", "/help               show this help", (*Client).metaHelp},
+	}
+}
+
+func findMetaCommand(name string) (metaCommand, bool) {
+	for _, cmd := range metaCommands() {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return metaCommand{}, false
+}
+
+// newCompleter returns a completer of the meta commands.
+func newCompleter() readline.AutoCompleter {
+	var items []readline.PrefixCompleterInterface
+	for _, cmd := range metaCommands() {
+		items = append(items, readline.PcItem(cmd.name))
+	}
+	return readline.NewPrefixCompleter(items...)
+}
+
+// parseLine makes the message from the input line.
+// Lines starting with "/" are meta commands, or slash commands if unknown.
+// It returns nil if there is nothing to send.
+func (c *Client) parseLine(line string) (*message.InMessage, error) {
+	if !strings.HasPrefix(line, "/") {
+		return newMessage(c.userName, c.channelName, line), nil
+	}
+
+	name, arg := splitCommand(line)
+	if cmd, ok := findMetaCommand(name); ok {
+		return cmd.action(c, arg)
+	}
+	return newCommand(c.userName, c.channelName, name, arg), nil
+}
+
+func (c *Client) metaUser(arg string) (*message.InMessage, error) {
+	if arg == "" {
+		return nil, fmt.Errorf("Usage: /user NAME")
+	}
+	c.userName = strings.TrimPrefix(arg, "@")
+	c.printSession()
+	return nil, nil
+}
+
+func (c *Client) metaChannel(arg string) (*message.InMessage, error) {
+	if arg == "" {
+		return nil, fmt.Errorf("Usage: /channel NAME")
+	}
+	c.channelName = strings.TrimPrefix(arg, "~")
+	c.printSession()
+	return nil, nil
+}
+
+func (c *Client) metaDM(arg string) (*message.InMessage, error) {
+	if arg == "" {
+		return nil, fmt.Errorf("Usage: /dm NAME")
+	}
+	c.userName = strings.TrimPrefix(arg, "@")
+	c.channelName = "@" + c.userName
+	c.printSession()
+	return nil, nil
+}
+
+// rawMessage is the fields of /raw.
+// Empty fields are filled with the current session.
+type rawMessage struct {
+	Type        string `json:"type"` // "public", "mention", "direct" or "command"
+	ChannelID   string `json:"channel_id"`
+	ChannelName string `json:"channel_name"`
+	UserID      string `json:"user_id"`
+	UserName    string `json:"user_name"`
+	PostID      string `json:"post_id"`
+	RootID      string `json:"root_id"`
+	Command     string `json:"command"`
+	TriggerID   string `json:"trigger_id"`
+	Text        string `json:"text"`
+}
+
+var rawMessageTypes = map[string]message.Type{
+	"public":  message.PublicMessage,
+	"mention": message.MentionMessage,
+	"direct":  message.DirectMessage,
+	"command": message.CommandMessage,
+}
+
+func (c *Client) metaRaw(arg string) (*message.InMessage, error) {
+	var raw rawMessage
+	if err := json.Unmarshal([]byte(arg), &raw); err != nil {
+		return nil, fmt.Errorf("Invalid JSON: %v", err)
+	}
+
+	user, channel := c.userName, c.channelName
+	if raw.UserName != "" {
+		user = raw.UserName
+	}
+	if raw.ChannelName != "" {
+		channel = raw.ChannelName
+	}
+
+	var msg *message.InMessage
+	if raw.Type == "command" || (raw.Type == "" && raw.Command != "") {
+		name, text := raw.Command, raw.Text
+		if name == "" {
+			name, text = splitCommand(raw.Text)
+		}
+		msg = newCommand(user, channel, name, text)
+	} else {
+		msg = newMessage(user, channel, raw.Text)
+	}
+
+	if raw.Type != "" {
+		t, ok := rawMessageTypes[raw.Type]
+		if !ok {
+			return nil, fmt.Errorf("Unknown message type: %q", raw.Type)
+		}
+		msg.Type = t
+	}
+	if raw.UserID != "" {
+		msg.UserID = raw.UserID
+	}
+	if raw.ChannelID != "" {
+		msg.ChannelID = raw.ChannelID
+	}
+	if raw.PostID != "" {
+		msg.PostID = raw.PostID
+	}
+	if raw.RootID != "" {
+		msg.RootID = raw.RootID
+	}
+	if raw.TriggerID != "" {
+		msg.TriggerID = raw.TriggerID
+	}
+
+	return msg, nil
+}
+
+func (c *Client) metaHelp(arg string) (*message.InMessage, error) {
+	w := c.infoWriter()
+	fmt.Fprintln(w, "Meta commands:")
+	for _, cmd := range metaCommands() {
+		fmt.Fprintln(w, "    "+cmd.usage)
+	}
+	fmt.Fprintln(w, "Other lines starting with \"/\" are sent as slash commands.")
+	fmt.Fprintln(w, `/raw fields: type ("public", "mention", "direct" or "command"), channel_id, channel_name,`)
+	fmt.Fprintln(w, "    user_id, user_name, post_id, root_id, command, trigger_id, text")
+	return nil, nil
+}
+
+func (c *Client) printSession() {
+	fmt.Fprintf(c.infoWriter(), "[Shell] user: %s, channel: %s\n", c.userName, c.channelName)
+}
+
+func (c *Client) infoWriter() io.Writer {
+	if c.info == nil {
+		return os.Stdout
+	}
+	return c.info
+}
+
+// newMessage makes a message from the user in the channel.
+func newMessage(user, channel, text string) *message.InMessage {
+	var trigger string
+	if fields := strings.Fields(text); len(fields) > 0 {
+		trigger = fields[0]
+	}
+
+	return translateInMessage(&mmhook.InMessage{
+		ChannelID:   channel,
+		ChannelName: channel,
+		TeamDomain:  "shell",
+		TeamID:      "shell",
+		PostID:      strconv.FormatInt(time.Now().UnixNano(), 10),
+		Text:        text,
+		Timestamp:   strconv.FormatInt(time.Now().Unix(), 10),
+		Token:       "shell_token",
+		TriggerWord: trigger,
+		UserID:      user,
+		UserName:    user,
+	})
+}
+
+// newCommand makes a slash command from the user in the channel.
+func newCommand(user, channel, command, text string) *message.InMessage {
+	return translateCommand(&mmhook.SlashCommand{
+		ChannelID:   channel,
+		ChannelName: channel,
+		Command:     command,
+		TeamDomain:  "shell",
+		TeamID:      "shell",
+		Text:        text,
+		Token:       "shell_token",
+		TriggerID:   strconv.FormatInt(time.Now().UnixNano(), 10),
+		UserID:      user,
+		UserName:    user,
+	})
+}
+
+// splitCommand splits the line into the first word and the rest.
+func splitCommand(line string) (string, string) {
+	line = strings.TrimSpace(line)
+	if i := strings.IndexAny(line, " \t\n"); i >= 0 {
+		return line[:i], strings.TrimSpace(line[i+1:])
+	}
+	return line, ""
+}
@@ -13,7 +13,12 @@ type Readline struct {
 
 // NewReadline returns new Readline with prompt.
 func NewReadline(prompt string) (*Readline, error) {
-	rl, err := readline.New(prompt)
+	return NewReadlineEx(&readline.Config{Prompt: prompt})
+}
+
+// NewReadlineEx returns new Readline with config.
+func NewReadlineEx(config *readline.Config) (*Readline, error) {
+	rl, err := readline.NewEx(config)
 	if err != nil {
 		return nil, err
 	}
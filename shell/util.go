@@ -1,49 +1,117 @@
 package shell
 
 import (
+	"bytes"
+	"fmt"
 	"strings"
 
+	"github.com/yukithm/mmbot/internal/webhook"
 	"github.com/yukithm/mmbot/message"
 	"github.com/yukithm/mmbot/mmhook"
 )
 
 func translateInMessage(msg *mmhook.InMessage) *message.InMessage {
 	return &message.InMessage{
-		Type:        messageType(msg),
+		Type:        webhook.MessageType(msg.ChannelName, msg.Text),
 		ChannelID:   msg.ChannelID,
 		ChannelName: msg.ChannelName,
 		UserID:      msg.UserID,
 		UserName:    msg.UserName,
+		PostID:      msg.PostID,
 		Text:        msg.Text,
 		RawMessage:  msg,
 	}
 }
 
-func translateOutMessage(msg *message.OutMessage) *mmhook.OutMessage {
-	var channel string
-	if msg.InReplyTo != nil {
-		channel = msg.InReplyTo.ChannelName
-	} else if msg.TriggeredBy != nil {
-		channel = msg.TriggeredBy.ChannelName
-	} else {
-		channel = msg.ChannelName
+func translateCommand(cmd *mmhook.SlashCommand) *message.InMessage {
+	return &message.InMessage{
+		Type:        message.CommandMessage,
+		ChannelID:   cmd.ChannelID,
+		ChannelName: cmd.ChannelName,
+		UserID:      cmd.UserID,
+		UserName:    cmd.UserName,
+		Command:     cmd.Command,
+		TriggerID:   cmd.TriggerID,
+		Text:        webhook.CommandText(cmd.Command, cmd.Text),
+		RawMessage:  cmd,
 	}
+}
 
+func translateOutMessage(msg *message.OutMessage) *mmhook.OutMessage {
 	return &mmhook.OutMessage{
-		Text:     msg.Text,
-		Channel:  channel,
-		UserName: msg.UserName,
-		IconURL:  msg.IconURL,
+		Text:        msg.Text,
+		Channel:     webhook.OutChannel(msg),
+		UserName:    msg.UserName,
+		IconURL:     msg.IconURL,
+		RootID:      msg.RootID,
+		Attachments: msg.Attachments,
+		Props:       msg.Props,
+		Type:        msg.Type,
 	}
 }
 
-func messageType(msg *mmhook.InMessage) message.Type {
-	if strings.HasPrefix(msg.ChannelName, "@") {
-		return message.DirectMessage
+// formatAttachment returns a human-readable representation of the attachment.
+func formatAttachment(a *message.Attachment) string {
+	var lines []string
+	if a.Pretext != "" {
+		lines = append(lines, a.Pretext)
+	}
+	if a.AuthorName != "" {
+		lines = append(lines, withLink(a.AuthorName, a.AuthorLink))
+	}
+	if a.Title != "" {
+		lines = append(lines, withLink(a.Title, a.TitleLink))
+	}
+	if a.Text != "" {
+		lines = append(lines, strings.Split(a.Text, "\n")...)
+	}
+	for _, f := range a.Fields {
+		values := strings.Split(f.Value, "\n")
+		lines = append(lines, fmt.Sprintf("%s: %s", f.Title, values[0]))
+		lines = append(lines, values[1:]...)
+	}
+	if a.ImageURL != "" {
+		lines = append(lines, "[image] "+a.ImageURL)
+	}
+	if a.ThumbURL != "" {
+		lines = append(lines, "[thumb] "+a.ThumbURL)
 	}
-	if strings.HasPrefix(msg.Text, "@") {
-		return message.MentionMessage
+	if len(a.Actions) > 0 {
+		lines = append(lines, formatActions(a.Actions))
+	}
+	if a.Footer != "" {
+		lines = append(lines, "-- "+a.Footer)
+	}
+	if len(lines) == 0 && a.Fallback != "" {
+		lines = append(lines, a.Fallback)
+	}
+
+	if a.Color != "" && len(lines) > 0 {
+		lines[0] = fmt.Sprintf("(%s) %s", a.Color, lines[0])
 	}
 
-	return message.PublicMessage
+	var buf bytes.Buffer
+	for _, line := range lines {
+		fmt.Fprintf(&buf, "    | %s\n", line)
+	}
+	return buf.String()
+}
+
+func withLink(text, link string) string {
+	if link == "" {
+		return text
+	}
+	return fmt.Sprintf("%s <%s>", text, link)
+}
+
+func formatActions(actions []*message.Action) string {
+	buttons := make([]string, len(actions))
+	for i, action := range actions {
+		if action.Type == message.SelectAction {
+			buttons[i] = "[" + action.Name + " v]"
+		} else {
+			buttons[i] = "[" + action.Name + "]"
+		}
+	}
+	return strings.Join(buttons, " ")
 }